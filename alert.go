@@ -0,0 +1,687 @@
+package ino
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	AlertWatchlist = "watchlist"
+	AlertZoneEnter = "zone_enter"
+	AlertNavStatus = "nav_status"
+	AlertSpeed     = "speed"
+
+	defaultAlertCooldown = 10 * time.Minute
+	// maxAlertCooldowns is how many vessel and rule pairs can be cooling
+	// down before expired ones are swept out.
+	maxAlertCooldowns = 10000
+)
+
+// AlertConditions narrow down what an alert rule fires on. Which are needed
+// depends on the rule's kind; MMSIs can limit any kind to those vessels.
+type AlertConditions struct {
+	MMSIs              []int64    `json:"mmsis,omitempty"`
+	ZoneID             null.Int   `json:"zoneId"`
+	NavigationStatuses []string   `json:"navigationStatuses,omitempty"`
+	MinSpeed           null.Float `json:"minSpeed"`
+	// BBox is min longitude, min latitude, max longitude, max latitude.
+	BBox []float64 `json:"bbox,omitempty"`
+}
+
+type AlertRule struct {
+	AlertRuleID int64          `json:"alertRuleId" db:"alert_rule_id"`
+	Name        string         `json:"name" db:"name"`
+	Kind        string         `json:"kind" db:"kind"`
+	Conditions  types.JSONText `json:"conditions" db:"conditions"`
+	WebhookURL  string         `json:"webhookUrl" db:"webhook_url"`
+	// Secret signs the webhooks, so receivers can tell they came from here.
+	Secret          string    `json:"secret" db:"secret"`
+	CooldownSeconds int64     `json:"-" db:"cooldown_seconds"`
+	Cooldown        string    `json:"cooldown" db:"-"`
+	Active          bool      `json:"active" db:"active"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time `json:"updatedAt" db:"updated_at"`
+
+	conditions AlertConditions
+}
+
+// AlertRuleInput is the body of a request to add or replace an alert rule.
+type AlertRuleInput struct {
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	Conditions AlertConditions `json:"conditions"`
+	WebhookURL string          `json:"webhookUrl"`
+	// Secret is generated when it's left out.
+	Secret   string `json:"secret"`
+	Cooldown string `json:"cooldown"`
+	Active   *bool  `json:"active"`
+}
+
+// AlertObservation is what the ingest pipeline saw of a vessel in one
+// message. Fields the message didn't carry are null.
+type AlertObservation struct {
+	MMSI             int64
+	Latitude         null.Float
+	Longitude        null.Float
+	Speed            null.Float
+	NavigationStatus null.String
+	At               time.Time
+}
+
+// AlertEvent is the body of a webhook.
+type AlertEvent struct {
+	AlertRuleID      int64       `json:"alertRuleId"`
+	RuleName         string      `json:"ruleName"`
+	Kind             string      `json:"kind"`
+	MMSI             int64       `json:"mmsi"`
+	Latitude         null.Float  `json:"latitude"`
+	Longitude        null.Float  `json:"longitude"`
+	Speed            null.Float  `json:"speed"`
+	NavigationStatus null.String `json:"navigationStatus"`
+	ZoneID           null.Int    `json:"zoneId"`
+	OccurredAt       time.Time   `json:"occurredAt"`
+	// Test is set on events sent to try a rule's webhook out.
+	Test bool `json:"test,omitempty"`
+}
+
+func (r *AlertRule) parse() error {
+	r.Cooldown = durationLabel(time.Duration(r.CooldownSeconds) * time.Second)
+	return json.Unmarshal(r.Conditions, &r.conditions)
+}
+
+// matches reports whether an observation meets the rule's conditions, apart
+// from the kind specific change a nav status rule looks for.
+func (r *AlertRule) matches(o *AlertObservation, zones *ZoneTracker) bool {
+	c := &r.conditions
+	if len(c.MMSIs) > 0 && !containsInt64(c.MMSIs, o.MMSI) {
+		return false
+	}
+
+	switch r.Kind {
+	case AlertWatchlist:
+		return true
+	case AlertNavStatus:
+		return o.NavigationStatus.Valid && containsString(c.NavigationStatuses, o.NavigationStatus.String)
+	case AlertSpeed:
+		if !o.Speed.Valid || o.Speed.Float64 < c.MinSpeed.Float64 {
+			return false
+		}
+		if len(c.BBox) == 0 && !c.ZoneID.Valid {
+			return true
+		}
+		if !o.Latitude.Valid || !o.Longitude.Valid {
+			return false
+		}
+		lat, lon := o.Latitude.Float64, o.Longitude.Float64
+		if len(c.BBox) == 4 && (lon < c.BBox[0] || lat < c.BBox[1] || lon > c.BBox[2] || lat > c.BBox[3]) {
+			return false
+		}
+		if c.ZoneID.Valid && (zones == nil || !zones.InZone(c.ZoneID.Int64, lat, lon)) {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func containsInt64(list []int64, v int64) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type AlertOptions struct {
+	// MaxAttempts is how many times a webhook is tried before it's given up
+	// on.
+	MaxAttempts int
+	// Backoff is how long to wait after the first failure, doubling with
+	// each one after up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each webhook request.
+	Timeout time.Duration
+}
+
+type cooldownKey struct {
+	ruleID int64
+	mmsi   int64
+}
+
+// AlertEngine checks what the ingest pipeline sees against the alert rules
+// and queues a webhook for each match. A rule fires for a vessel at most
+// once per cooldown.
+type AlertEngine struct {
+	DB *DB
+	// Zones answers whether positions are in the zones rules refer to.
+	Zones   *ZoneTracker
+	options AlertOptions
+	client  *http.Client
+
+	mu        sync.Mutex
+	rules     []*AlertRule
+	navStatus map[int64]string
+	cooldowns map[cooldownKey]time.Time
+
+	// sendMu guards the deliveries being sent and how many are in flight to
+	// each host.
+	sendMu   sync.Mutex
+	inflight map[int64]bool
+	hosts    map[string]int
+	sends    sync.WaitGroup
+
+	wake     chan struct{}
+	shutdown chan struct{}
+	stopped  chan struct{}
+}
+
+func NewAlertEngine(db *DB, zones *ZoneTracker, options *AlertOptions) (*AlertEngine, error) {
+	e := &AlertEngine{
+		DB:        db,
+		Zones:     zones,
+		options:   *options,
+		client:    &http.Client{Timeout: options.Timeout},
+		cooldowns: map[cooldownKey]time.Time{},
+		inflight:  map[int64]bool{},
+		hosts:     map[string]int{},
+		wake:      make(chan struct{}, 1),
+		shutdown:  make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+
+	// Nav status rules fire on a change, so start from what's stored rather
+	// than treating every vessel's first report after a restart as one.
+	navStatus, err := db.GetNavigationStatuses()
+	if err != nil {
+		return nil, err
+	}
+	e.navStatus = navStatus
+	return e, nil
+}
+
+// Reload picks up changes to the rules.
+func (e *AlertEngine) Reload() error {
+	rules, err := e.DB.GetAlertRules()
+	if err != nil {
+		return err
+	}
+	active := []*AlertRule{}
+	for _, r := range rules {
+		if r.Active {
+			active = append(active, r)
+		}
+	}
+
+	e.mu.Lock()
+	e.rules = active
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *AlertEngine) activeRules() []*AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rules
+}
+
+// Observe checks a vessel against the watchlist, nav status and speed
+// rules.
+func (e *AlertEngine) Observe(o *AlertObservation) {
+	changed := false
+	if o.NavigationStatus.Valid {
+		e.mu.Lock()
+		previous, seen := e.navStatus[o.MMSI]
+		changed = seen && previous != o.NavigationStatus.String
+		e.navStatus[o.MMSI] = o.NavigationStatus.String
+		e.mu.Unlock()
+	}
+
+	for _, r := range e.activeRules() {
+		if r.Kind == AlertZoneEnter || (r.Kind == AlertNavStatus && !changed) {
+			continue
+		}
+		if !r.matches(o, e.Zones) {
+			continue
+		}
+		e.fire(r, &AlertEvent{
+			MMSI:             o.MMSI,
+			Latitude:         o.Latitude,
+			Longitude:        o.Longitude,
+			Speed:            o.Speed,
+			NavigationStatus: o.NavigationStatus,
+			OccurredAt:       o.At,
+		})
+	}
+}
+
+// ZoneEntered checks a vessel entering a zone against the zone rules.
+func (e *AlertEngine) ZoneEntered(zoneID int64, mmsi int64, lat float64, lon float64, at time.Time) {
+	for _, r := range e.activeRules() {
+		if r.Kind != AlertZoneEnter || r.conditions.ZoneID.Int64 != zoneID {
+			continue
+		}
+		if len(r.conditions.MMSIs) > 0 && !containsInt64(r.conditions.MMSIs, mmsi) {
+			continue
+		}
+		e.fire(r, &AlertEvent{
+			MMSI:       mmsi,
+			Latitude:   null.FloatFrom(lat),
+			Longitude:  null.FloatFrom(lon),
+			ZoneID:     null.IntFrom(zoneID),
+			OccurredAt: at,
+		})
+	}
+}
+
+// fire queues a webhook for the event unless the rule is cooling down for
+// the vessel.
+func (e *AlertEngine) fire(r *AlertRule, event *AlertEvent) {
+	now := time.Now()
+	key := cooldownKey{r.AlertRuleID, event.MMSI}
+
+	e.mu.Lock()
+	if until, ok := e.cooldowns[key]; ok && now.Before(until) {
+		e.mu.Unlock()
+		return
+	}
+	if len(e.cooldowns) >= maxAlertCooldowns {
+		for k, until := range e.cooldowns {
+			if !now.Before(until) {
+				delete(e.cooldowns, k)
+			}
+		}
+	}
+	e.cooldowns[key] = now.Add(time.Duration(r.CooldownSeconds) * time.Second)
+	e.mu.Unlock()
+
+	event.AlertRuleID = r.AlertRuleID
+	event.RuleName = r.Name
+	event.Kind = r.Kind
+	if _, err := e.enqueue(event); err != nil {
+		slog.Error("Couldn't queue alert", "alertRuleId", r.AlertRuleID, "mmsi", event.MMSI, slog.Any("error", err))
+	}
+}
+
+// enqueue stores a delivery for the event and wakes the dispatcher.
+func (e *AlertEngine) enqueue(event *AlertEvent) (*AlertDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := e.DB.AddAlertDelivery(event.AlertRuleID, payload)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return delivery, nil
+}
+
+func (db *DB) GetAlertRules() ([]*AlertRule, error) {
+	rules := []*AlertRule{}
+	err := db.Select(&rules, `
+		select
+			alert_rule_id,
+			name,
+			kind,
+			conditions,
+			webhook_url,
+			secret,
+			cooldown_seconds,
+			active,
+			created_at,
+			updated_at
+		from
+			alert_rule
+		order by
+			alert_rule_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if err := r.parse(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func (db *DB) GetAlertRule(ruleID int) (*AlertRule, error) {
+	rule := &AlertRule{}
+	err := db.Get(rule, `
+		select
+			alert_rule_id,
+			name,
+			kind,
+			conditions,
+			webhook_url,
+			secret,
+			cooldown_seconds,
+			active,
+			created_at,
+			updated_at
+		from
+			alert_rule
+		where
+			alert_rule_id = $1
+	`, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	return rule, rule.parse()
+}
+
+func (db *DB) AddAlertRule(rule *AlertRuleInput, cooldown time.Duration) (*AlertRule, error) {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	r := &AlertRule{}
+	err = db.Get(r, `
+		insert into alert_rule (name, kind, conditions, webhook_url, secret, cooldown_seconds, active)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		returning
+			alert_rule_id,
+			name,
+			kind,
+			conditions,
+			webhook_url,
+			secret,
+			cooldown_seconds,
+			active,
+			created_at,
+			updated_at
+	`, rule.Name, rule.Kind, conditions, rule.WebhookURL, rule.Secret, int64(cooldown.Seconds()), *rule.Active)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.parse()
+}
+
+func (db *DB) UpdateAlertRule(ruleID int, rule *AlertRuleInput, cooldown time.Duration) (*AlertRule, error) {
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	r := &AlertRule{}
+	err = db.Get(r, `
+		update alert_rule
+		set
+			name = $2,
+			kind = $3,
+			conditions = $4,
+			webhook_url = $5,
+			secret = coalesce(nullif($6, ''), secret),
+			cooldown_seconds = $7,
+			active = $8,
+			updated_at = now()
+		where
+			alert_rule_id = $1
+		returning
+			alert_rule_id,
+			name,
+			kind,
+			conditions,
+			webhook_url,
+			secret,
+			cooldown_seconds,
+			active,
+			created_at,
+			updated_at
+	`, ruleID, rule.Name, rule.Kind, conditions, rule.WebhookURL, rule.Secret, int64(cooldown.Seconds()), *rule.Active)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.parse()
+}
+
+// DeleteAlertRule removes a rule along with its delivery log.
+func (db *DB) DeleteAlertRule(ruleID int) error {
+	var deleted int64
+	return db.QueryRow("delete from alert_rule where alert_rule_id = $1 returning alert_rule_id", ruleID).Scan(&deleted)
+}
+
+// GetNavigationStatuses is every vessel's last known nav status.
+func (db *DB) GetNavigationStatuses() (map[int64]string, error) {
+	var rows []struct {
+		MMSI             int64  `db:"mmsi"`
+		NavigationStatus string `db:"navigation_status"`
+	}
+	err := db.Select(&rows, "select mmsi, navigation_status from vessel where navigation_status is not null")
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[int64]string, len(rows))
+	for _, r := range rows {
+		statuses[r.MMSI] = r.NavigationStatus
+	}
+	return statuses, nil
+}
+
+// validateAlertRule checks a rule has what its kind needs, filling in
+// defaults, and returns its cooldown.
+func (s *HTTPServer) validateAlertRule(rule *AlertRuleInput, creating bool) (time.Duration, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return 0, badRequestf("ino: name is required")
+	}
+
+	u, err := url.Parse(rule.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0, badRequestf("ino: invalid webhookUrl '%v', must be an http or https URL", rule.WebhookURL)
+	}
+
+	c := &rule.Conditions
+	switch rule.Kind {
+	case AlertWatchlist:
+		if len(c.MMSIs) == 0 {
+			return 0, badRequestf("ino: a watchlist rule needs mmsis")
+		}
+	case AlertZoneEnter:
+		if !c.ZoneID.Valid {
+			return 0, badRequestf("ino: a zone_enter rule needs a zoneId")
+		}
+	case AlertNavStatus:
+		if len(c.NavigationStatuses) == 0 {
+			return 0, badRequestf("ino: a nav_status rule needs navigationStatuses")
+		}
+	case AlertSpeed:
+		if !c.MinSpeed.Valid || c.MinSpeed.Float64 <= 0 {
+			return 0, badRequestf("ino: a speed rule needs a minSpeed above 0")
+		}
+	default:
+		return 0, badRequestf("ino: invalid kind '%v', must be watchlist, zone_enter, nav_status or speed", rule.Kind)
+	}
+	if len(c.BBox) != 0 && (len(c.BBox) != 4 || c.BBox[0] > c.BBox[2] || c.BBox[1] > c.BBox[3]) {
+		return 0, badRequestf("ino: bbox needs min longitude, min latitude, max longitude and max latitude")
+	}
+	if c.ZoneID.Valid {
+		if _, err := s.DB.GetZone(int(c.ZoneID.Int64)); err != nil {
+			return 0, badRequestf("ino: zone %v doesn't exist", c.ZoneID.Int64)
+		}
+	}
+
+	cooldown := defaultAlertCooldown
+	if rule.Cooldown != "" {
+		cooldown, err = time.ParseDuration(rule.Cooldown)
+		if err != nil || cooldown < 0 {
+			return 0, badRequestf("ino: invalid cooldown '%v'", rule.Cooldown)
+		}
+	}
+
+	if rule.Active == nil {
+		active := true
+		rule.Active = &active
+	}
+	if rule.Secret == "" && creating {
+		if rule.Secret, err = newWebhookSecret(); err != nil {
+			return 0, err
+		}
+	}
+	return cooldown, nil
+}
+
+// reloadAlerts has the engine pick up a change to the rules.
+func (s *HTTPServer) reloadAlerts() error {
+	if s.Alerts == nil {
+		return nil
+	}
+	return s.Alerts.Reload()
+}
+
+// Alert rules hold webhook secrets, so even reading them needs an admin key.
+
+func (s *HTTPServer) GetAlertRules(w http.ResponseWriter, r *http.Request) error {
+	if err := authorize(r, APIKeyAdmin); err != nil {
+		return err
+	}
+
+	rules, err := s.DB.GetAlertRules()
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+	return nil
+}
+
+func (s *HTTPServer) GetAlertRule(w http.ResponseWriter, r *http.Request) error {
+	if err := authorize(r, APIKeyAdmin); err != nil {
+		return err
+	}
+
+	ruleID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	rule, err := s.DB.GetAlertRule(ruleID)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+	return nil
+}
+
+func (s *HTTPServer) CreateAlertRule(w http.ResponseWriter, r *http.Request) error {
+	var body AlertRuleInput
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	cooldown, err := s.validateAlertRule(&body, true)
+	if err != nil {
+		return err
+	}
+
+	rule, err := s.DB.AddAlertRule(&body, cooldown)
+	if err != nil {
+		return err
+	}
+	if err := s.reloadAlerts(); err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, rule)
+	return nil
+}
+
+func (s *HTTPServer) UpdateAlertRule(w http.ResponseWriter, r *http.Request) error {
+	ruleID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	var body AlertRuleInput
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	cooldown, err := s.validateAlertRule(&body, false)
+	if err != nil {
+		return err
+	}
+
+	rule, err := s.DB.UpdateAlertRule(ruleID, &body, cooldown)
+	if err != nil {
+		return err
+	}
+	if err := s.reloadAlerts(); err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, rule)
+	return nil
+}
+
+func (s *HTTPServer) DeleteAlertRule(w http.ResponseWriter, r *http.Request) error {
+	ruleID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := s.DB.DeleteAlertRule(ruleID); err != nil {
+		return err
+	}
+	if err := s.reloadAlerts(); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// TestAlertRule queues a made up event for a rule, to check its webhook
+// works.
+func (s *HTTPServer) TestAlertRule(w http.ResponseWriter, r *http.Request) error {
+	ruleID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	rule, err := s.DB.GetAlertRule(ruleID)
+	if err != nil {
+		return err
+	}
+	if s.Alerts == nil {
+		return notFoundf("ino: alerts aren't being sent")
+	}
+
+	delivery, err := s.Alerts.enqueue(&AlertEvent{
+		AlertRuleID: rule.AlertRuleID,
+		RuleName:    rule.Name,
+		Kind:        rule.Kind,
+		OccurredAt:  time.Now(),
+		Test:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusAccepted, delivery)
+	return nil
+}
@@ -0,0 +1,392 @@
+package ino
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/guregu/null/v5"
+)
+
+const (
+	// APIKeyRead can call every GET route.
+	APIKeyRead = "read"
+	// APIKeyAdmin can also manage feeds and call anything that changes state.
+	APIKeyAdmin = "admin"
+)
+
+// apiKeyTokenPrefix marks ino keys so they're recognizable in config files
+// and secret scanners.
+const apiKeyTokenPrefix = "ino_"
+
+type APIKey struct {
+	APIKeyID     int64     `json:"apiKeyId" db:"api_key_id"`
+	Name         string    `json:"name" db:"name"`
+	Prefix       string    `json:"prefix" db:"prefix"`
+	Role         string    `json:"role" db:"role"`
+	RequestCount int64     `json:"requestCount" db:"request_count"`
+	LastUsedAt   null.Time `json:"lastUsedAt" db:"last_used_at"`
+	RevokedAt    null.Time `json:"revokedAt" db:"revoked_at"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Allows reports whether the key's role is enough for a route that needs
+// the given one.
+func (k *APIKey) Allows(role string) bool {
+	return role == APIKeyRead || k.Role == APIKeyAdmin
+}
+
+// hashAPIKey is what's stored in place of a key. Keys are random and long
+// enough that a plain digest can't be brute forced.
+func hashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new key and returns it along with its token, which
+// is the only time the token is available.
+func (db *DB) CreateAPIKey(name string, role string) (*APIKey, string, error) {
+	if role != APIKeyRead && role != APIKeyAdmin {
+		return nil, "", fmt.Errorf("ino: invalid role '%v', must be %v or %v", role, APIKeyRead, APIKeyAdmin)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	token := apiKeyTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	key := &APIKey{}
+	err := db.Get(key, `
+		insert into api_key (name, prefix, key_hash, role)
+		values ($1, $2, $3, $4)
+		returning
+			api_key_id,
+			name,
+			prefix,
+			role,
+			request_count,
+			last_used_at,
+			revoked_at,
+			created_at
+	`, name, token[:len(apiKeyTokenPrefix)+8], hashAPIKey(token), role)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+// RevokeAPIKey stops a key from being accepted. Revoking a key that doesn't
+// exist or is already revoked is sql.ErrNoRows.
+func (db *DB) RevokeAPIKey(apiKeyID int64) (*APIKey, error) {
+	key := &APIKey{}
+	err := db.Get(key, `
+		update api_key
+		set revoked_at = now()
+		where
+			api_key_id = $1
+			and revoked_at is null
+		returning
+			api_key_id,
+			name,
+			prefix,
+			role,
+			request_count,
+			last_used_at,
+			revoked_at,
+			created_at
+	`, apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (db *DB) GetAPIKeys() ([]*APIKey, error) {
+	keys := []*APIKey{}
+	err := db.Select(&keys, `
+		select
+			api_key_id,
+			name,
+			prefix,
+			role,
+			request_count,
+			last_used_at,
+			revoked_at,
+			created_at
+		from
+			api_key
+		order by
+			api_key_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByToken finds the unrevoked key a token belongs to.
+func (db *DB) GetAPIKeyByToken(token string) (*APIKey, error) {
+	key := &APIKey{}
+	err := db.Get(key, `
+		select
+			api_key_id,
+			name,
+			prefix,
+			role,
+			request_count,
+			last_used_at,
+			revoked_at,
+			created_at
+		from
+			api_key
+		where
+			key_hash = $1
+			and revoked_at is null
+	`, hashAPIKey(token))
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// apiKeyUsage is what's accumulated for a key between flushes.
+type apiKeyUsage struct {
+	requests int64
+	lastUsed time.Time
+}
+
+// AddAPIKeyUsage adds requests made with a key to its totals.
+func (db *DB) AddAPIKeyUsage(apiKeyID int64, requests int64, lastUsed time.Time) error {
+	_, err := db.Exec(`
+		update api_key
+		set
+			request_count = request_count + $2,
+			last_used_at = greatest(last_used_at, $3)
+		where
+			api_key_id = $1
+	`, apiKeyID, requests, lastUsed)
+	return err
+}
+
+type AuthOptions struct {
+	// Required rejects requests without a key. Otherwise they're treated as
+	// having a read key.
+	Required bool
+	// CacheTTL is how long a looked up key is trusted before it's checked
+	// again, which bounds how long a revoked key keeps working.
+	CacheTTL time.Duration
+}
+
+type cachedAPIKey struct {
+	key      *APIKey
+	loadedAt time.Time
+}
+
+// Authenticator resolves the API key a request carries and keeps count of
+// what each key is used for.
+type Authenticator struct {
+	DB       *DB
+	options  AuthOptions
+	mu       sync.Mutex
+	keys     map[string]cachedAPIKey
+	usage    map[int64]*apiKeyUsage
+	shutdown chan struct{}
+	stopped  chan struct{}
+}
+
+func NewAuthenticator(db *DB, options *AuthOptions) *Authenticator {
+	a := &Authenticator{
+		DB:       db,
+		options:  *options,
+		keys:     map[string]cachedAPIKey{},
+		usage:    map[int64]*apiKeyUsage{},
+		shutdown: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	return a
+}
+
+// Start writes accumulated usage to the database every interval until
+// Shutdown is called.
+func (a *Authenticator) Start(interval time.Duration) {
+	go func() {
+		defer close(a.stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				a.flush()
+			case <-a.shutdown:
+				a.flush()
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops the flush loop after writing out what's left.
+func (a *Authenticator) Shutdown() {
+	close(a.shutdown)
+	<-a.stopped
+}
+
+func (a *Authenticator) flush() {
+	a.mu.Lock()
+	usage := a.usage
+	a.usage = map[int64]*apiKeyUsage{}
+	a.mu.Unlock()
+
+	for id, u := range usage {
+		if err := a.DB.AddAPIKeyUsage(id, u.requests, u.lastUsed); err != nil {
+			slog.Error("Couldn't record API key usage", "apiKeyId", id, slog.Any("error", err))
+		}
+	}
+}
+
+// known reports whether the token is a key that's cached and fresh, so
+// looking it up won't touch the database.
+func (a *Authenticator) known(token string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cached, ok := a.keys[token]
+	return ok && cached.key != nil && time.Since(cached.loadedAt) < a.options.CacheTTL
+}
+
+// lookup finds the key for a token, from the cache when it's fresh. Unknown
+// tokens aren't cached, so made up ones can't fill the cache; the rate
+// limiter keeps them from hammering the database instead.
+func (a *Authenticator) lookup(token string) (*APIKey, error) {
+	now := time.Now()
+	a.mu.Lock()
+	cached, ok := a.keys[token]
+	a.mu.Unlock()
+	if ok && now.Sub(cached.loadedAt) < a.options.CacheTTL {
+		return cached.key, nil
+	}
+
+	key, err := a.DB.GetAPIKeyByToken(token)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if key == nil {
+		return nil, nil
+	}
+
+	a.mu.Lock()
+	for t, c := range a.keys {
+		if now.Sub(c.loadedAt) >= a.options.CacheTTL {
+			delete(a.keys, t)
+		}
+	}
+	a.keys[token] = cachedAPIKey{key: key, loadedAt: now}
+	a.mu.Unlock()
+
+	return key, nil
+}
+
+func (a *Authenticator) record(key *APIKey, at time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u, ok := a.usage[key.APIKeyID]
+	if !ok {
+		u = &apiKeyUsage{}
+		a.usage[key.APIKeyID] = u
+	}
+	u.requests++
+	u.lastUsed = at
+}
+
+// requestToken pulls the key from the Authorization or X-API-Key headers.
+// Browsers can't set headers on EventSource or WebSocket requests, so the
+// api_key query parameter works too.
+func requestToken(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); v != "" {
+		scheme, token, ok := strings.Cut(v, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if v := r.Header.Get("X-API-Key"); v != "" {
+		return v
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+type apiKeyContextKey struct{}
+
+// RequestAPIKey is the key a request was made with, or nil for anonymous
+// requests.
+func RequestAPIKey(ctx context.Context) *APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return key
+}
+
+// Middleware attaches the request's key to its context, rejecting unknown
+// or revoked keys and, when keys are required, requests without one.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		if token == "" {
+			if a.options.Required {
+				httpError(w, r, unauthorizedf("ino: an API key is required"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := a.lookup(token)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		if key == nil {
+			httpError(w, r, unauthorizedf("ino: invalid API key"))
+			return
+		}
+
+		a.record(key, time.Now())
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+// requiredRole is the role a route needs. Reads are open to every key, and
+// anything that changes state needs an admin key.
+func requiredRole(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return APIKeyRead
+	default:
+		return APIKeyAdmin
+	}
+}
+
+// authorize checks the request's key has the role a route needs. Without a
+// key, only read routes are allowed, and only if the Authenticator let the
+// request through.
+func authorize(r *http.Request, role string) error {
+	key := RequestAPIKey(r.Context())
+	if key == nil {
+		if role == APIKeyRead {
+			return nil
+		}
+		return unauthorizedf("ino: an %v API key is required", role)
+	}
+	if !key.Allows(role) {
+		return &APIError{Status: http.StatusForbidden, Err: fmt.Errorf("ino: API key '%v' doesn't have the %v role", key.Name, role)}
+	}
+	return nil
+}
@@ -0,0 +1,636 @@
+package ino
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	ArchiveKindPacket  = "packet"
+	ArchiveKindMessage = "message"
+
+	// archivePacketIDTag is the TAG block parameter packet archives carry
+	// each packet's id in.
+	archivePacketIDTag = "ino-id"
+)
+
+type Archive struct {
+	ArchiveID int64     `json:"archiveId" db:"archive_id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Day       time.Time `json:"day" db:"day"`
+	Path      string    `json:"path" db:"path"`
+	RowCount  int64     `json:"rowCount" db:"row_count"`
+	FirstID   int64     `json:"firstId" db:"first_id"`
+	LastID    int64     `json:"lastId" db:"last_id"`
+	SHA256    string    `json:"sha256" db:"sha256"`
+	Purged    bool      `json:"purged" db:"purged"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type archivedPacket struct {
+	PacketID  int64     `db:"packet_id"`
+	Raw       string    `db:"raw"`
+	FeedID    int64     `db:"feed_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type archivedMessage struct {
+	MessageID int64     `db:"message_id" parquet:"message_id"`
+	MMSI      int64     `db:"mmsi" parquet:"mmsi"`
+	Type      int64     `db:"type" parquet:"type"`
+	Message   string    `db:"message" parquet:"message,json"`
+	Raw       string    `db:"raw" parquet:"raw"`
+	FeedID    int64     `db:"feed_id" parquet:"feed_id"`
+	CreatedAt time.Time `db:"created_at" parquet:"created_at,timestamp(microsecond)"`
+	// ReceptionFeedIDs and ReceptionTimes (unix microseconds) record every
+	// feed that heard the message, in the order they heard it.
+	ReceptionFeedIDs pq.Int64Array `db:"reception_feed_ids" parquet:"reception_feed_ids,list"`
+	ReceptionTimes   pq.Int64Array `db:"reception_times" parquet:"reception_times,list"`
+}
+
+type ArchiverOptions struct {
+	// Dir is the root directory archive files are written beneath.
+	Dir string
+	// OlderThan is how old a day has to be before it's archived.
+	OlderThan time.Duration
+	// Purge deletes rows from the database once they're safely on disk.
+	Purge bool
+}
+
+type Archiver struct {
+	DB      *DB
+	options ArchiverOptions
+	job     *periodicJob
+}
+
+func NewArchiver(db *DB, options *ArchiverOptions) *Archiver {
+	a := &Archiver{
+		DB:      db,
+		options: *options,
+		job:     newPeriodicJob(),
+	}
+	return a
+}
+
+// Start runs the archiver immediately and then every interval until Shutdown
+// is called.
+func (a *Archiver) Start(interval time.Duration) {
+	a.job.start(interval, "Couldn't archive", func() error {
+		archives, err := a.Run()
+		if len(archives) > 0 {
+			slog.Info("Archived days", "count", len(archives))
+		}
+		return err
+	})
+}
+
+func (a *Archiver) Shutdown() {
+	a.job.stop()
+}
+
+// Run exports every complete UTC day older than the threshold that hasn't
+// been archived yet, one file per kind per day.
+func (a *Archiver) Run() ([]*Archive, error) {
+	cutoff := time.Now().UTC().Add(-a.options.OlderThan).Truncate(24 * time.Hour)
+
+	archives := []*Archive{}
+	for _, kind := range []string{ArchiveKindPacket, ArchiveKindMessage} {
+		days, err := a.DB.GetUnarchivedDays(kind, cutoff)
+		if err != nil {
+			return archives, err
+		}
+		for _, day := range days {
+			archive, err := a.archiveDay(kind, day)
+			if err != nil {
+				return archives, err
+			}
+			if archive == nil {
+				continue
+			}
+			slog.Info("Archived day", "kind", kind, "day", day.Format(time.DateOnly), "rows", archive.RowCount, "path", archive.Path)
+			archives = append(archives, archive)
+		}
+	}
+	return archives, nil
+}
+
+func (a *Archiver) archiveDay(kind string, day time.Time) (*Archive, error) {
+	ext := ".nmea.gz"
+	if kind == ArchiveKindMessage {
+		ext = ".parquet"
+	}
+	path := filepath.Join(a.options.Dir, kind, day.Format("2006"), kind+"-"+day.Format(time.DateOnly)+ext)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	h := sha256.New()
+	w := io.MultiWriter(f, h)
+
+	archive := &Archive{
+		Kind: kind,
+		Day:  day,
+		Path: path,
+	}
+
+	if kind == ArchiveKindMessage {
+		err = a.DB.writeMessageArchive(w, day, archive)
+	} else {
+		err = a.DB.writePacketArchive(w, day, archive)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if archive.RowCount == 0 {
+		return nil, nil
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	archive.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	if err := a.DB.AddArchive(archive); err != nil {
+		return nil, err
+	}
+
+	if a.options.Purge {
+		if err := a.DB.PurgeArchive(archive); err != nil {
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
+
+func (db *DB) writePacketArchive(w io.Writer, day time.Time, archive *Archive) error {
+	rows, err := db.Queryx(`
+		select
+			packet_id,
+			raw,
+			feed_id,
+			created_at
+		from
+			packet
+		where
+			created_at >= $1 and created_at < $2
+		order by packet_id
+	`, day, day.Add(24*time.Hour))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	gz := gzip.NewWriter(w)
+	bw := bufio.NewWriter(gz)
+	for rows.Next() {
+		var p archivedPacket
+		if err := rows.StructScan(&p); err != nil {
+			return err
+		}
+
+		// The packet id goes in a parameter of our own, which other readers
+		// ignore, so an import puts the packet back where it was.
+		tag := formatTagBlock("c:"+strconv.FormatInt(p.CreatedAt.UnixMilli(), 10), "s:"+strconv.FormatInt(p.FeedID, 10), archivePacketIDTag+":"+strconv.FormatInt(p.PacketID, 10))
+		if _, err := bw.WriteString(tag + strings.TrimRight(p.Raw, "\r\n") + "\n"); err != nil {
+			return err
+		}
+
+		archive.track(p.PacketID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (db *DB) writeMessageArchive(w io.Writer, day time.Time, archive *Archive) error {
+	rows, err := db.Queryx(`
+		select
+			message_id,
+			mmsi,
+			type,
+			message,
+			raw,
+			feed_id,
+			created_at,
+			array(
+				select r.feed_id from message_reception r
+				where r.message_id = m.message_id
+				order by r.created_at
+			) reception_feed_ids,
+			array(
+				select (extract(epoch from r.created_at) * 1000000)::bigint from message_reception r
+				where r.message_id = m.message_id
+				order by r.created_at
+			) reception_times
+		from
+			message m
+		where
+			created_at >= $1 and created_at < $2
+		order by message_id
+	`, day, day.Add(24*time.Hour))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	pw := parquet.NewGenericWriter[archivedMessage](w, parquet.Compression(&parquet.Zstd))
+	batch := make([]archivedMessage, 0, 1024)
+	for rows.Next() {
+		var m archivedMessage
+		if err := rows.StructScan(&m); err != nil {
+			return err
+		}
+		batch = append(batch, m)
+		archive.track(m.MessageID)
+
+		if len(batch) == cap(batch) {
+			if _, err := pw.Write(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := pw.Write(batch); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+func (a *Archive) track(id int64) {
+	if a.RowCount == 0 || id < a.FirstID {
+		a.FirstID = id
+	}
+	if id > a.LastID {
+		a.LastID = id
+	}
+	a.RowCount++
+}
+
+func (db *DB) GetUnarchivedDays(kind string, cutoff time.Time) ([]time.Time, error) {
+	var first *time.Time
+	var err error
+	switch kind {
+	case ArchiveKindPacket:
+		err = db.QueryRow("select min(created_at) from packet").Scan(&first)
+	case ArchiveKindMessage:
+		err = db.QueryRow("select min(created_at) from message").Scan(&first)
+	default:
+		return nil, fmt.Errorf("ino: unknown archive kind %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		return nil, nil
+	}
+
+	var archived []time.Time
+	err = db.Select(&archived, "select day from archive where kind = $1", kind)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(archived))
+	for _, d := range archived {
+		done[d.Format(time.DateOnly)] = true
+	}
+
+	days := []time.Time{}
+	for d := first.UTC().Truncate(24 * time.Hour); d.Before(cutoff); d = d.Add(24 * time.Hour) {
+		if !done[d.Format(time.DateOnly)] {
+			days = append(days, d)
+		}
+	}
+	return days, nil
+}
+
+func (db *DB) AddArchive(a *Archive) error {
+	err := db.QueryRow(`
+		insert into archive
+		(kind, day, path, row_count, first_id, last_id, sha256)
+		values
+		($1, $2, $3, $4, $5, $6, $7)
+		returning archive_id, created_at
+	`, a.Kind, a.Day, a.Path, a.RowCount, a.FirstID, a.LastID, a.SHA256).Scan(&a.ArchiveID, &a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// PurgeArchive deletes the rows covered by an archive from the database.
+func (db *DB) PurgeArchive(a *Archive) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var query string
+	switch a.Kind {
+	case ArchiveKindPacket:
+		query = "delete from packet where created_at >= $1 and created_at < $2 and packet_id between $3 and $4"
+	case ArchiveKindMessage:
+		query = "delete from message where created_at >= $1 and created_at < $2 and message_id between $3 and $4"
+	default:
+		return fmt.Errorf("ino: unknown archive kind %q", a.Kind)
+	}
+
+	_, err = tx.Exec(query, a.Day, a.Day.Add(24*time.Hour), a.FirstID, a.LastID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("update archive set purged = true where archive_id = $1", a.ArchiveID)
+	if err != nil {
+		return err
+	}
+
+	a.Purged = true
+	return tx.Commit()
+}
+
+func (db *DB) GetArchives() ([]*Archive, error) {
+	archives := []*Archive{}
+	err := db.Select(&archives, `
+		select
+			archive_id,
+			kind,
+			day,
+			path,
+			row_count,
+			first_id,
+			last_id,
+			sha256,
+			purged,
+			created_at
+		from
+			archive
+		order by day, kind
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
+
+// ImportArchive loads an archive file written by the Archiver back into the
+// database, returning the number of rows inserted. Files are matched to the
+// manifest by their contents rather than their path, and ones whose rows are
+// still present are refused to avoid duplicating them.
+func (db *DB) ImportArchive(path string) (int64, error) {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var archiveID int64
+	var purged bool
+	err = db.QueryRow("select archive_id, purged from archive where sha256 = $1", sum).Scan(&archiveID, &purged)
+	switch {
+	case err == nil && !purged:
+		return 0, fmt.Errorf("ino: rows from %v haven't been purged", path)
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	}
+
+	var n int64
+	switch {
+	case strings.HasSuffix(path, ".nmea.gz"):
+		// Only files we wrote, going by the manifest, get their ids back.
+		n, err = db.importPacketArchive(path, archiveID != 0)
+	case strings.HasSuffix(path, ".parquet"):
+		n, err = db.importMessageArchive(path)
+	default:
+		return 0, fmt.Errorf("ino: don't know how to import %v", path)
+	}
+	if err != nil || archiveID == 0 {
+		return n, err
+	}
+
+	_, err = db.Exec("update archive set purged = false where archive_id = $1", archiveID)
+	return n, err
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (db *DB) importPacketArchive(path string, keepIDs bool) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Packets keep the ids they were archived with. Files without them, from
+	// before ids were archived, or that aren't in the manifest get new ones.
+	stmt, err := tx.Prepare(`
+		insert into packet
+		(packet_id, raw, feed_id, created_at)
+		values
+		(coalesce($1::bigint, nextval(pg_get_serial_sequence('packet', 'packet_id'))), $2, $3, $4)
+		on conflict (packet_id) do nothing
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var n, line int64
+	s := bufio.NewScanner(gz)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line++
+		tags, raw, err := parseTagBlock(s.Text())
+		if err != nil {
+			return n, err
+		}
+
+		c, err := strconv.ParseInt(tags["c"], 10, 64)
+		if err != nil {
+			return n, fmt.Errorf("ino: bad tag block timestamp on line %v: %w", line, err)
+		}
+		feedID, err := strconv.ParseInt(tags["s"], 10, 64)
+		if err != nil {
+			return n, fmt.Errorf("ino: bad tag block source on line %v: %w", line, err)
+		}
+
+		// Older archives and third party files use seconds rather than
+		// milliseconds, which are easy to tell apart by magnitude.
+		createdAt := time.UnixMilli(c)
+		if c < 100000000000 {
+			createdAt = time.Unix(c, 0)
+		}
+
+		var packetID sql.NullInt64
+		if v, ok := tags[archivePacketIDTag]; ok && keepIDs {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return n, fmt.Errorf("ino: bad tag block packet id on line %v: %w", line, err)
+			}
+			packetID = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		res, err := stmt.Exec(packetID, raw+"\r\n", feedID, createdAt)
+		if err != nil {
+			return n, err
+		}
+		if inserted, _ := res.RowsAffected(); inserted > 0 {
+			n++
+		}
+	}
+	if err := s.Err(); err != nil {
+		return n, err
+	}
+	if err := catchUpSequence(tx, "packet", "packet_id"); err != nil {
+		return n, err
+	}
+	return n, tx.Commit()
+}
+
+func (db *DB) importMessageArchive(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	pr := parquet.NewGenericReader[archivedMessage](f)
+	defer pr.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Preparex(`
+		insert into message
+		(message_id, mmsi, type, message, raw, feed_id, created_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7)
+		on conflict (message_id) do nothing
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	receptionStmt, err := tx.Preparex(`
+		insert into message_reception
+		(message_id, feed_id, created_at)
+		select $1, unnest($2::integer[]), to_timestamp(unnest($3::bigint[]) / 1000000.0)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer receptionStmt.Close()
+
+	var n int64
+	batch := make([]archivedMessage, 1024)
+	for {
+		c, err := pr.Read(batch)
+		for _, m := range batch[:c] {
+			res, err := stmt.Exec(m.MessageID, m.MMSI, m.Type, m.Message, m.Raw, m.FeedID, m.CreatedAt)
+			if err != nil {
+				return n, err
+			}
+			if inserted, _ := res.RowsAffected(); inserted == 0 {
+				continue
+			}
+
+			feedIDs, times := m.ReceptionFeedIDs, m.ReceptionTimes
+			if len(feedIDs) == 0 {
+				feedIDs, times = pq.Int64Array{m.FeedID}, pq.Int64Array{m.CreatedAt.UnixMicro()}
+			}
+			if _, err := receptionStmt.Exec(m.MessageID, feedIDs, times); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if err := catchUpSequence(tx, "message", "message_id"); err != nil {
+		return n, err
+	}
+	return n, tx.Commit()
+}
+
+// catchUpSequence moves a table's id sequence past ids imported with their
+// original values, which can be ahead of it in a restored database.
+func catchUpSequence(tx interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+}, table string, column string) error {
+	_, err := tx.Exec(fmt.Sprintf(`
+		select setval(seq, max_id)
+		from (
+			select pg_get_serial_sequence('%[1]v', '%[2]v')::regclass seq, max(%[2]v) max_id
+			from %[1]v
+		) s
+		where max_id > coalesce(pg_sequence_last_value(seq), 0)
+	`, table, column))
+	return err
+}
@@ -0,0 +1,135 @@
+package ino
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// archiveTestDay is long before any real data, so the test has it to itself.
+var archiveTestDay = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const archiveTestRaw = "!AIVDM,1,1,,A,15M67FC000G?ufbE`FepT@3n00Sa,0*5C\r\n"
+
+func TestArchiveRoundTrip(t *testing.T) {
+	db := openArchiveTestDB(t)
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		var id int64
+		err := db.QueryRow(`
+			insert into packet (raw, feed_id, created_at)
+			values ($1, $2, $3)
+			returning packet_id
+		`, archiveTestRaw, benchFeedID, archiveTestDay.Add(time.Duration(i)*time.Hour)).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	dir := t.TempDir()
+	a := NewArchiver(db, &ArchiverOptions{Dir: dir, Purge: true})
+	archive, err := a.archiveDay(ArchiveKindPacket, archiveTestDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.RowCount != 3 || !archive.Purged {
+		t.Fatalf("archived %v rows, purged %v, want 3 purged", archive.RowCount, archive.Purged)
+	}
+	if got := archiveTestPacketIDs(t, db); len(got) != 0 {
+		t.Fatalf("packets %v are still there after purging", got)
+	}
+
+	// The guard goes by contents, so a moved copy is still recognized.
+	moved := filepath.Join(t.TempDir(), "moved.nmea.gz")
+	if err := os.Rename(archive.Path, moved); err != nil {
+		t.Fatal(err)
+	}
+	n, err := db.ImportArchive(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("imported %v packets, want 3", n)
+	}
+	got := archiveTestPacketIDs(t, db)
+	if len(got) != len(ids) {
+		t.Fatalf("got packets %v back, want %v", got, ids)
+	}
+	for i := range ids {
+		if got[i] != ids[i] {
+			t.Fatalf("got packets %v back, want %v", got, ids)
+		}
+	}
+
+	if _, err := db.ImportArchive(moved); err == nil {
+		t.Fatal("importing again while the rows are present worked")
+	}
+}
+
+func TestArchiveImportForeign(t *testing.T) {
+	db := openArchiveTestDB(t)
+
+	var existing int64
+	if err := db.QueryRow("select coalesce(max(packet_id), 0) + 1 from packet").Scan(&existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file we didn't write, whose ids mean nothing here, shouldn't have
+	// them trusted, nor its line counts mistaken for them.
+	path := filepath.Join(t.TempDir(), "foreign.nmea.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	for _, fields := range [][]string{
+		{"c:946684800", "s:1", "n:1"},
+		{"c:946684801", "s:1", archivePacketIDTag + ":1"},
+	} {
+		gz.Write([]byte(formatTagBlock(fields...) + archiveTestRaw))
+	}
+	gz.Close()
+	f.Close()
+
+	n, err := db.ImportArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("imported %v packets, want 2", n)
+	}
+	for _, id := range archiveTestPacketIDs(t, db) {
+		if id < existing {
+			t.Errorf("imported packet got id %v, which was already taken", id)
+		}
+	}
+}
+
+func openArchiveTestDB(t *testing.T) *DB {
+	db := openTestDB(t)
+	cleanup := func() {
+		db.Exec("delete from packet where created_at >= $1 and created_at < $2", archiveTestDay, archiveTestDay.Add(24*time.Hour))
+		db.Exec("delete from archive where day = $1", archiveTestDay)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	return db
+}
+
+func archiveTestPacketIDs(t *testing.T, db *DB) []int64 {
+	t.Helper()
+	ids := []int64{}
+	err := db.Select(&ids, `
+		select packet_id from packet
+		where created_at >= $1 and created_at < $2
+		order by packet_id
+	`, archiveTestDay, archiveTestDay.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
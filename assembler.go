@@ -0,0 +1,199 @@
+package ino
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PacketErrorOrphaned is a fragment that couldn't belong to any message,
+	// such as a repeated fragment number or an inconsistent fragment count.
+	PacketErrorOrphaned = "orphaned"
+	// PacketErrorExpired is a fragment whose message never completed before
+	// the assembler's timeout.
+	PacketErrorExpired = "expired"
+)
+
+// fragmentKey identifies a multipart message within a feed. Each Monstah owns
+// its own assembler, so the feed is implicit.
+type fragmentKey struct {
+	channel  string
+	sequence string
+	group    string
+	count    int
+}
+
+type fragmentGroup struct {
+	lines     []string
+	received  int
+	firstSeen time.Time
+}
+
+type droppedFragment struct {
+	line   string
+	reason string
+	err    error
+}
+
+type FragmentStats struct {
+	FeedID        int    `json:"feedId"`
+	RemoteAddress string `json:"remoteAddress"`
+	Completed     int64  `json:"completed"`
+	Orphaned      int64  `json:"orphaned"`
+	Expired       int64  `json:"expired"`
+	Pending       int    `json:"pending"`
+}
+
+// FragmentAssembler stitches multipart sentences back together before they
+// reach the decoder, so that interleaved messages on different channels or
+// TAG groups that happen to share a sequential message id stay apart.
+type FragmentAssembler struct {
+	timeout time.Duration
+
+	mu        sync.Mutex
+	pending   map[fragmentKey]*fragmentGroup
+	completed int64
+	orphaned  int64
+	expired   int64
+}
+
+func NewFragmentAssembler(timeout time.Duration) *FragmentAssembler {
+	a := &FragmentAssembler{
+		timeout: timeout,
+		pending: make(map[fragmentKey]*fragmentGroup),
+	}
+	return a
+}
+
+// Add takes a validated line received at t and returns the lines of any
+// message it completes in fragment order, along with any fragments that had
+// to be given up on.
+func (a *FragmentAssembler) Add(line string, t time.Time) ([]string, []droppedFragment) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dropped := a.expire(t)
+
+	key, number, err := parseFragment(line)
+	if err != nil {
+		a.orphaned++
+		return nil, append(dropped, droppedFragment{line, PacketErrorOrphaned, err})
+	}
+
+	if key.count == 1 {
+		a.completed++
+		return []string{line}, dropped
+	}
+
+	g, ok := a.pending[key]
+	if ok && g.lines[number-1] != "" {
+		// A repeated fragment number means the message we were building was
+		// never going to complete, so give up on it and start over.
+		for _, l := range g.lines {
+			if l != "" {
+				a.orphaned++
+				dropped = append(dropped, droppedFragment{l, PacketErrorOrphaned, errors.New("ino: superseded by a later fragment with the same number")})
+			}
+		}
+		ok = false
+	}
+	if !ok {
+		g = &fragmentGroup{
+			lines:     make([]string, key.count),
+			firstSeen: t,
+		}
+		a.pending[key] = g
+	}
+
+	g.lines[number-1] = line
+	g.received++
+
+	if g.received < key.count {
+		return nil, dropped
+	}
+
+	delete(a.pending, key)
+	a.completed++
+	return g.lines, dropped
+}
+
+// Expire gives up on the messages that haven't completed within the timeout
+// as of t. Add does the same as lines come in, but a feed that goes quiet
+// needs this called to report what it left unfinished.
+func (a *FragmentAssembler) Expire(t time.Time) []droppedFragment {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.expire(t)
+}
+
+func (a *FragmentAssembler) expire(t time.Time) []droppedFragment {
+	var dropped []droppedFragment
+	for k, g := range a.pending {
+		if t.Sub(g.firstSeen) <= a.timeout {
+			continue
+		}
+		for _, l := range g.lines {
+			if l != "" {
+				a.expired++
+				dropped = append(dropped, droppedFragment{l, PacketErrorExpired, fmt.Errorf("ino: %v of %v fragments received within %v", g.received, k.count, a.timeout)})
+			}
+		}
+		delete(a.pending, k)
+	}
+	return dropped
+}
+
+// Stats returns the assembler's counters. The feed fields are left for the
+// caller to fill in.
+func (a *FragmentAssembler) Stats() FragmentStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return FragmentStats{
+		Completed: a.completed,
+		Orphaned:  a.orphaned,
+		Expired:   a.expired,
+		Pending:   len(a.pending),
+	}
+}
+
+// parseFragment pulls the fields that place a sentence within a multipart
+// message out of a line that's already passed validateSentence.
+func parseFragment(line string) (fragmentKey, int, error) {
+	tags, sentence, err := parseTagBlock(strings.TrimSpace(line))
+	if err != nil {
+		return fragmentKey{}, 0, err
+	}
+
+	fields := strings.Split(sentence, ",")
+	if len(fields) != 7 {
+		return fragmentKey{}, 0, fmt.Errorf("ino: has %v fields instead of 7", len(fields))
+	}
+
+	count, err := strconv.Atoi(fields[1])
+	if err != nil || count < 1 || count > 9 {
+		return fragmentKey{}, 0, fmt.Errorf("ino: invalid fragment count '%v'", fields[1])
+	}
+	number, err := strconv.Atoi(fields[2])
+	if err != nil || number < 1 || number > count {
+		return fragmentKey{}, 0, fmt.Errorf("ino: invalid fragment number '%v' of %v", fields[2], count)
+	}
+
+	key := fragmentKey{
+		channel:  fields[4],
+		sequence: fields[3],
+		count:    count,
+	}
+
+	// TAG block groups are "g:<sentence>-<total>-<group id>".
+	if g, ok := tags["g"]; ok {
+		parts := strings.Split(g, "-")
+		key.group = parts[len(parts)-1]
+	}
+
+	return key, number, nil
+}
@@ -0,0 +1,164 @@
+package ino
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFragmentAssembler(t *testing.T) {
+	const timeout = 2 * time.Second
+
+	type step struct {
+		line string
+		at   time.Duration
+	}
+	cases := []struct {
+		name  string
+		steps []step
+		// expire, when set, is when Expire is called after the steps.
+		expire   time.Duration
+		messages [][]string
+		dropped  []string
+		pending  int
+	}{
+		{
+			name:     "single",
+			steps:    []step{{fragment(1, 1, "", "A", "a"), 0}},
+			messages: [][]string{{fragment(1, 1, "", "A", "a")}},
+		},
+		{
+			name: "out of order",
+			steps: []step{
+				{fragment(2, 2, "3", "A", "a2"), 0},
+				{fragment(2, 1, "3", "A", "a1"), 0},
+			},
+			messages: [][]string{{fragment(2, 1, "3", "A", "a1"), fragment(2, 2, "3", "A", "a2")}},
+		},
+		{
+			name: "channels interleaved with the same sequence id",
+			steps: []step{
+				{fragment(2, 1, "3", "A", "a1"), 0},
+				{fragment(2, 1, "3", "B", "b1"), 0},
+				{fragment(2, 2, "3", "A", "a2"), 0},
+				{fragment(2, 2, "3", "B", "b2"), 0},
+			},
+			messages: [][]string{
+				{fragment(2, 1, "3", "A", "a1"), fragment(2, 2, "3", "A", "a2")},
+				{fragment(2, 1, "3", "B", "b1"), fragment(2, 2, "3", "B", "b2")},
+			},
+		},
+		{
+			name: "tag groups interleaved with the same sequence id",
+			steps: []step{
+				{formatTagBlock("g:1-2-42") + fragment(2, 1, "3", "A", "x1"), 0},
+				{formatTagBlock("g:1-2-43") + fragment(2, 1, "3", "A", "y1"), 0},
+				{formatTagBlock("g:2-2-43") + fragment(2, 2, "3", "A", "y2"), 0},
+				{formatTagBlock("g:2-2-42") + fragment(2, 2, "3", "A", "x2"), 0},
+			},
+			messages: [][]string{
+				{formatTagBlock("g:1-2-43") + fragment(2, 1, "3", "A", "y1"), formatTagBlock("g:2-2-43") + fragment(2, 2, "3", "A", "y2")},
+				{formatTagBlock("g:1-2-42") + fragment(2, 1, "3", "A", "x1"), formatTagBlock("g:2-2-42") + fragment(2, 2, "3", "A", "x2")},
+			},
+		},
+		{
+			name: "superseded partial message",
+			steps: []step{
+				{fragment(2, 1, "3", "A", "old"), 0},
+				{fragment(2, 1, "3", "A", "new"), 0},
+				{fragment(2, 2, "3", "A", "end"), 0},
+			},
+			messages: [][]string{{fragment(2, 1, "3", "A", "new"), fragment(2, 2, "3", "A", "end")}},
+			dropped:  []string{PacketErrorOrphaned + " " + fragment(2, 1, "3", "A", "old")},
+		},
+		{
+			name:    "invalid fragment number",
+			steps:   []step{{fragment(2, 3, "3", "A", "a"), 0}},
+			dropped: []string{PacketErrorOrphaned + " " + fragment(2, 3, "3", "A", "a")},
+		},
+		{
+			name: "expired by a later line",
+			steps: []step{
+				{fragment(2, 1, "3", "A", "a1"), 0},
+				{fragment(1, 1, "", "B", "b"), timeout + time.Second},
+			},
+			messages: [][]string{{fragment(1, 1, "", "B", "b")}},
+			dropped:  []string{PacketErrorExpired + " " + fragment(2, 1, "3", "A", "a1")},
+		},
+		{
+			name: "expired while the feed is quiet",
+			steps: []step{
+				{fragment(3, 1, "3", "A", "a1"), 0},
+				{fragment(3, 2, "3", "A", "a2"), time.Second},
+				{fragment(2, 1, "4", "A", "b1"), timeout},
+			},
+			expire: timeout + time.Second,
+			dropped: []string{
+				PacketErrorExpired + " " + fragment(3, 1, "3", "A", "a1"),
+				PacketErrorExpired + " " + fragment(3, 2, "3", "A", "a2"),
+			},
+			pending: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			start := time.Unix(1700000000, 0)
+			a := NewFragmentAssembler(timeout)
+
+			messages := [][]string{}
+			dropped := []string{}
+			record := func(ds []droppedFragment) {
+				for _, d := range ds {
+					dropped = append(dropped, d.reason+" "+d.line)
+				}
+			}
+			for _, s := range c.steps {
+				lines, ds := a.Add(s.line, start.Add(s.at))
+				if lines != nil {
+					messages = append(messages, lines)
+				}
+				record(ds)
+			}
+			if c.expire != 0 {
+				record(a.Expire(start.Add(c.expire)))
+			}
+
+			if !slices.EqualFunc(messages, c.messages, slices.Equal) {
+				t.Errorf("messages %q, want %q", messages, c.messages)
+			}
+			slices.Sort(dropped)
+			want := slices.Clone(c.dropped)
+			slices.Sort(want)
+			if !slices.Equal(dropped, want) {
+				t.Errorf("dropped %q, want %q", dropped, want)
+			}
+
+			stats := a.Stats()
+			if stats.Pending != c.pending {
+				t.Errorf("%v pending, want %v", stats.Pending, c.pending)
+			}
+			if int(stats.Completed) != len(c.messages) {
+				t.Errorf("%v completed, want %v", stats.Completed, len(c.messages))
+			}
+			var orphaned, expired int
+			for _, d := range c.dropped {
+				if strings.HasPrefix(d, PacketErrorOrphaned) {
+					orphaned++
+				} else {
+					expired++
+				}
+			}
+			if int(stats.Orphaned) != orphaned || int(stats.Expired) != expired {
+				t.Errorf("%v orphaned and %v expired, want %v and %v", stats.Orphaned, stats.Expired, orphaned, expired)
+			}
+		})
+	}
+}
+
+// fragment makes a sentence that's one of count parts of a message. The
+// checksum isn't right, which the assembler leaves to validateSentence.
+func fragment(count int, number int, sequence string, channel string, payload string) string {
+	return fmt.Sprintf("!AIVDM,%v,%v,%v,%v,%v,0*00", count, number, sequence, channel, payload)
+}
@@ -0,0 +1,249 @@
+package ino
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// vesselsCacheTTL is short since vessels move, but long enough that a
+	// room full of dashboards polling the map shares one query.
+	vesselsCacheTTL = 5 * time.Second
+	// statsCacheTTL covers the message and error stats, which aggregate
+	// whole tables and change slowly.
+	statsCacheTTL = 30 * time.Second
+	// maxCacheEntries bounds the cache when clients vary their queries.
+	maxCacheEntries = 1000
+)
+
+// compressibleTypes are the response types worth gzipping.
+var compressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/vnd.geo+json",
+	"application/vnd.google-earth.kml+xml",
+	"application/gpx+xml",
+	"application/vnd.mapbox-vector-tile",
+	"text/csv",
+	"text/plain",
+}
+
+// cachedResponse is a rendered response, kept plain and gzipped so neither
+// has to be produced again while it's fresh.
+type cachedResponse struct {
+	header  http.Header
+	body    []byte
+	gzipped []byte
+	etag    string
+	expires time.Time
+}
+
+// cacheFill is a response being rendered, which concurrent requests for the
+// same thing wait on rather than repeating the query.
+type cacheFill struct {
+	done     chan struct{}
+	response *cachedResponse
+	err      error
+}
+
+// ResponseCache keeps rendered responses for expensive routes for a short
+// time, so load on Postgres doesn't grow with the number of clients.
+type ResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	filling map[string]*cacheFill
+}
+
+func NewResponseCache() *ResponseCache {
+	c := &ResponseCache{
+		entries: map[string]*cachedResponse{},
+		filling: map[string]*cacheFill{},
+	}
+	return c
+}
+
+// cacheKey is what distinguishes one rendering of a route from another.
+// Query values are encoded sorted, and the Accept header matters because it
+// can pick the format.
+func cacheKey(r *http.Request) string {
+	return r.URL.Path + "?" + r.URL.Query().Encode() + "\n" + r.Header.Get("Accept")
+}
+
+// get returns a fresh response for the request, rendering it with handler
+// if there isn't one.
+func (c *ResponseCache) get(r *http.Request, ttl time.Duration, handler HTTPApiFunc) (*cachedResponse, error) {
+	key := cacheKey(r)
+	now := time.Now()
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e, nil
+	}
+	if f, ok := c.filling[key]; ok {
+		c.mu.Unlock()
+		<-f.done
+		return f.response, f.err
+	}
+	f := &cacheFill{done: make(chan struct{})}
+	c.filling[key] = f
+	c.mu.Unlock()
+
+	f.response, f.err = render(r, handler)
+	if f.response != nil {
+		f.response.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	delete(c.filling, key)
+	if f.response != nil {
+		c.store(key, f.response, now)
+	}
+	c.mu.Unlock()
+	close(f.done)
+
+	return f.response, f.err
+}
+
+// store adds an entry, making room by dropping expired entries and then,
+// if that's not enough, whichever expire soonest. Callers hold mu.
+func (c *ResponseCache) store(key string, response *cachedResponse, now time.Time) {
+	if len(c.entries) >= maxCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	for len(c.entries) >= maxCacheEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = response
+}
+
+// responseBuffer collects what a handler writes so it can be cached.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// render runs a handler into a buffer. Only successful responses are worth
+// keeping; anything else is reported as an error for httpError to write.
+func render(r *http.Request, handler HTTPApiFunc) (*cachedResponse, error) {
+	b := &responseBuffer{header: http.Header{}}
+	if err := handler(b, r); err != nil {
+		return nil, err
+	}
+	if b.status != http.StatusOK {
+		return nil, fmt.Errorf("ino: cached route %v responded %v", r.URL.Path, b.status)
+	}
+
+	body := b.body.Bytes()
+	sum := sha256.Sum256(body)
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(body)
+	gz.Close()
+
+	return &cachedResponse{
+		header:  b.header,
+		body:    body,
+		gzipped: gzipped.Bytes(),
+		etag:    `W/"` + hex.EncodeToString(sum[:12]) + `"`,
+	}, nil
+}
+
+// etagMatches reports whether an If-None-Match header names the etag.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the client will take a gzipped body.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// cached serves a route from the server's cache, with an ETag so clients
+// polling it can skip the body when nothing's changed. Without a cache the
+// handler is called directly.
+func (s *HTTPServer) cached(ttl time.Duration, handler HTTPApiFunc) HTTPApiFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if s.Cache == nil {
+			return handler(w, r)
+		}
+
+		response, err := s.Cache.get(r, ttl, handler)
+		if err != nil {
+			return err
+		}
+
+		h := w.Header()
+		for k, v := range response.header {
+			h[k] = append([]string(nil), v...)
+		}
+		h.Set("ETag", response.etag)
+		h.Set("Cache-Control", fmt.Sprintf("max-age=%d", int(time.Until(response.expires).Seconds())))
+		h.Add("Vary", "Accept")
+
+		if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, response.etag) {
+			h.Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+
+		h.Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			h.Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusOK)
+			w.Write(response.gzipped)
+			return nil
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(response.body)
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+// Package client is a typed Go client for the ino HTTP API. The request and
+// response types and the API methods in api.go are generated from the
+// OpenAPI spec; run go generate after changing openapi.json.
+package client
+
+//go:generate go run gen.go -spec ../openapi.json -out api.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls an ino server.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is added to every request, for things like credentials.
+	Header http.Header
+}
+
+func New(baseURL string) *Client {
+	c := &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Header:     http.Header{},
+	}
+	return c
+}
+
+// Error is a non-2xx response, with the problem details the server sent.
+type Error struct {
+	StatusCode int
+	Problem    *Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem != nil && e.Problem.Detail != nil {
+		return fmt.Sprintf("ino: %d %s: %s", e.StatusCode, e.Problem.Title, *e.Problem.Detail)
+	}
+	return fmt.Sprintf("ino: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// do makes a request, sending body as JSON when it isn't nil, and returns
+// the body of a successful response, which is empty for 204 No Content.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, accept string) ([]byte, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", accept)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode}
+		p := &Problem{}
+		if json.Unmarshal(respBody, p) == nil && p.Status != 0 {
+			e.Problem = p
+		}
+		return nil, e
+	}
+
+	return respBody, nil
+}
+
+// decode unmarshals a JSON response body into v.
+func decode(body []byte, v interface{}) error {
+	if len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
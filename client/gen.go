@@ -0,0 +1,536 @@
+//go:build ignore
+
+// gen writes the client's types and API methods from the OpenAPI spec. It
+// understands the subset of OpenAPI that openapi.json uses.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// object is a JSON object that remembers the order of its keys, so the
+// generated code follows the spec's order.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *object) get(key string) interface{} {
+	if o == nil {
+		return nil
+	}
+	return o.values[key]
+}
+
+func (o *object) obj(key string) *object {
+	v, _ := o.get(key).(*object)
+	return v
+}
+
+func (o *object) str(key string) string {
+	v, _ := o.get(key).(string)
+	return v
+}
+
+func (o *object) list(key string) []interface{} {
+	v, _ := o.get(key).([]interface{})
+	return v
+}
+
+func parse(dec *json.Decoder) (interface{}, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		o := &object{values: map[string]interface{}{}}
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := parse(dec)
+			if err != nil {
+				return nil, err
+			}
+			o.keys = append(o.keys, k.(string))
+			o.values[k.(string)] = v
+		}
+		_, err := dec.Token()
+		return o, err
+	case json.Delim('['):
+		var l []interface{}
+		for dec.More() {
+			v, err := parse(dec)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, v)
+		}
+		_, err := dec.Token()
+		return l, err
+	default:
+		return t, nil
+	}
+}
+
+type generator struct {
+	spec    *object
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteString("\n")
+}
+
+func (g *generator) resolve(o *object) *object {
+	for o != nil && o.str("$ref") != "" {
+		o = g.lookup(o.str("$ref"))
+	}
+	return o
+}
+
+func (g *generator) lookup(ref string) *object {
+	o := g.spec
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		o = o.obj(part)
+	}
+	return o
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+var initialisms = map[string]string{
+	"bbox": "BBox",
+	"id":   "ID",
+	"imo":  "IMO",
+	"json": "JSON",
+	"mmsi": "MMSI",
+	"url":  "URL",
+}
+
+// goName turns a camelCase JSON name into an exported Go name.
+func goName(s string) string {
+	var words []string
+	start := 0
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) {
+			words = append(words, s[start:i])
+			start = i
+		}
+	}
+	words = append(words, s[start:])
+
+	var b strings.Builder
+	for _, w := range words {
+		if i, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(i)
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// schemaType returns the schema's type name and whether it can be null.
+func schemaType(schema *object) (string, bool) {
+	switch t := schema.get("type").(type) {
+	case string:
+		return t, false
+	case []interface{}:
+		name, nullable := "", false
+		for _, v := range t {
+			if v == "null" {
+				nullable = true
+			} else {
+				name = v.(string)
+			}
+		}
+		return name, nullable
+	}
+	return "", false
+}
+
+// goType renders a schema as a Go type. Optional and nullable scalars and
+// structs become pointers.
+func (g *generator) goType(schema *object, optional bool) string {
+	if ref := schema.str("$ref"); ref != "" {
+		if optional {
+			return "*" + refName(ref)
+		}
+		return refName(ref)
+	}
+
+	t, nullable := schemaType(schema)
+	var base string
+	switch t {
+	case "string":
+		switch schema.str("format") {
+		case "date-time":
+			g.imports["time"] = true
+			base = "time.Time"
+		case "binary":
+			return "[]byte"
+		default:
+			base = "string"
+		}
+	case "integer":
+		base = "int64"
+	case "number":
+		base = "float64"
+	case "boolean":
+		base = "bool"
+	case "array":
+		return "[]" + g.goType(schema.obj("items"), false)
+	case "object":
+		if additional := schema.obj("additionalProperties"); additional != nil {
+			return "map[string]" + g.goType(additional, false)
+		}
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	default:
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+
+	if optional || nullable {
+		return "*" + base
+	}
+	return base
+}
+
+func (g *generator) fields(schema *object) {
+	required := map[string]bool{}
+	for _, r := range schema.list("required") {
+		required[r.(string)] = true
+	}
+	properties := schema.obj("properties")
+	if properties == nil {
+		return
+	}
+	for _, name := range properties.keys {
+		prop := properties.obj(name)
+		if desc := prop.str("description"); desc != "" {
+			g.p("// %v", desc)
+		}
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		g.p("%v %v `json:%q`", goName(name), g.goType(prop, !required[name]), tag)
+	}
+}
+
+func (g *generator) schemas() {
+	schemas := g.spec.obj("components").obj("schemas")
+	for _, name := range schemas.keys {
+		schema := schemas.obj(name)
+		if desc := schema.str("description"); desc != "" {
+			g.p("// %v is %v", name, strings.ToLower(desc[:1])+desc[1:])
+		}
+		g.p("type %v struct {", name)
+		if allOf := schema.list("allOf"); allOf != nil {
+			for _, part := range allOf {
+				part := part.(*object)
+				if ref := part.str("$ref"); ref != "" {
+					g.p("%v", refName(ref))
+				} else {
+					g.fields(part)
+				}
+			}
+		} else {
+			g.fields(schema)
+		}
+		g.p("}")
+		g.p("")
+	}
+}
+
+type param struct {
+	name     string
+	goName   string
+	goType   string
+	in       string
+	required bool
+	array    bool
+}
+
+func (g *generator) params(op *object) []param {
+	var params []param
+	for _, v := range op.list("parameters") {
+		p := g.resolve(v.(*object))
+		schema := p.obj("schema")
+		name := p.str("name")
+		gn := p.str("x-go-name")
+		if gn == "" {
+			gn = goName(name)
+		}
+		required, _ := p.get("required").(bool)
+		t, _ := schemaType(schema)
+		params = append(params, param{
+			name:     name,
+			goName:   gn,
+			goType:   g.goType(schema, p.str("in") == "query" && !required && t != "array"),
+			in:       p.str("in"),
+			required: required,
+			array:    t == "array",
+		})
+	}
+	return params
+}
+
+// formatValue renders a Go expression of the given type as a query or path
+// value.
+func (g *generator) formatValue(goType string, expr string) string {
+	switch strings.TrimPrefix(goType, "*") {
+	case "int64", "float64", "bool":
+		g.imports["strconv"] = true
+	case "time.Time":
+		g.imports["time"] = true
+	}
+	switch strings.TrimPrefix(goType, "*") {
+	case "int64":
+		return fmt.Sprintf("strconv.FormatInt(%v, 10)", expr)
+	case "float64":
+		return fmt.Sprintf("strconv.FormatFloat(%v, 'f', -1, 64)", expr)
+	case "bool":
+		return fmt.Sprintf("strconv.FormatBool(%v)", expr)
+	case "time.Time":
+		return fmt.Sprintf("(%v).Format(time.RFC3339)", expr)
+	default:
+		return expr
+	}
+}
+
+type variant struct {
+	suffix     string
+	accept     string
+	returnType string
+	raw        bool
+}
+
+func (g *generator) operations() {
+	paths := g.spec.obj("paths")
+	for _, path := range paths.keys {
+		item := paths.obj(path)
+		for _, method := range item.keys {
+			op := item.obj(method)
+			if skip, _ := op.get("x-contract-skip").(bool); skip {
+				continue
+			}
+			g.operation(strings.ToUpper(method), path, op)
+		}
+	}
+}
+
+func (g *generator) operation(method string, path string, op *object) {
+	id := op.str("operationId")
+	var content *object
+	noContent := false
+	for _, status := range []string{"200", "201", "204"} {
+		if response := op.obj("responses").obj(status); response != nil {
+			content = g.resolve(response).obj("content")
+			noContent = status == "204"
+			break
+		}
+	}
+	if content == nil && !noContent {
+		return
+	}
+
+	var variants []variant
+	if noContent {
+		variants = append(variants, variant{"", "", "", false})
+		content = &object{}
+	}
+	for _, mediaType := range content.keys {
+		schema := content.obj(mediaType).obj("schema")
+		switch mediaType {
+		case "application/json":
+			t := g.goType(schema, false)
+			if g.resolve(schema).get("properties") != nil || g.resolve(schema).get("allOf") != nil {
+				t = "*" + t
+			}
+			variants = append(variants, variant{"", mediaType, t, false})
+		case "application/vnd.geo+json":
+			g.imports["encoding/json"] = true
+			variants = append(variants, variant{"GeoJSON", mediaType, "json.RawMessage", true})
+		case "application/vnd.mapbox-vector-tile":
+			variants = append(variants, variant{"", mediaType, "[]byte", true})
+		}
+	}
+	if len(variants) == 0 {
+		return
+	}
+
+	params := g.params(op)
+	var pathParams, queryParams []param
+	for _, p := range params {
+		if p.in == "path" {
+			pathParams = append(pathParams, p)
+		} else {
+			queryParams = append(queryParams, p)
+		}
+	}
+
+	g.imports["context"] = true
+	if len(pathParams) > 0 {
+		g.imports["strings"] = true
+	}
+	if len(queryParams) > 0 {
+		g.imports["net/url"] = true
+		g.p("// %vParams are the query parameters for %v.", id, id)
+		g.p("type %vParams struct {", id)
+		for _, p := range queryParams {
+			g.p("%v %v", p.goName, p.goType)
+		}
+		g.p("}")
+		g.p("")
+		g.p("func (p *%vParams) values() url.Values {", id)
+		g.p("q := url.Values{}")
+		g.p("if p == nil {")
+		g.p("return q")
+		g.p("}")
+		for _, p := range queryParams {
+			if p.array {
+				g.p("for _, v := range p.%v {", p.goName)
+				g.p("q.Add(%q, %v)", p.name, g.formatValue(strings.TrimPrefix(p.goType, "[]"), "v"))
+				g.p("}")
+				continue
+			}
+			if p.required {
+				g.p("q.Set(%q, %v)", p.name, g.formatValue(p.goType, "p."+p.goName))
+				continue
+			}
+			g.p("if p.%v != nil {", p.goName)
+			g.p("q.Set(%q, %v)", p.name, g.formatValue(p.goType, "*p."+p.goName))
+			g.p("}")
+		}
+		g.p("return q")
+		g.p("}")
+		g.p("")
+	}
+
+	args := []string{"ctx context.Context"}
+	urlPath := fmt.Sprintf("%q", path)
+	for _, p := range pathParams {
+		arg := strings.ToLower(p.goName[:1]) + p.goName[1:]
+		if p.goName == strings.ToUpper(p.goName) {
+			arg = strings.ToLower(p.goName)
+		}
+		args = append(args, arg+" "+p.goType)
+		urlPath = fmt.Sprintf("strings.Replace(%v, %q, %v, 1)", urlPath, "{"+p.name+"}", g.formatValue(p.goType, arg))
+	}
+	query := "nil"
+	if len(queryParams) > 0 {
+		args = append(args, fmt.Sprintf("params *%vParams", id))
+		query = "params.values()"
+	}
+	requestBody := "nil"
+	if schema := op.obj("requestBody").obj("content").obj("application/json").obj("schema"); schema != nil {
+		args = append(args, "body *"+g.goType(schema, false))
+		requestBody = "body"
+	}
+
+	for _, v := range variants {
+		summary := op.str("summary")
+		if v.suffix == "GeoJSON" {
+			summary += " as GeoJSON"
+		}
+		g.p("// %v%v calls %v %v (%v).", id, v.suffix, method, path, summary)
+		if v.returnType == "" {
+			g.p("func (c *Client) %v(%v) error {", id, strings.Join(args, ", "))
+			g.p("_, err := c.do(ctx, %q, %v, %v, %v, %q)", method, urlPath, query, requestBody, "application/json")
+			g.p("return err")
+			g.p("}")
+			g.p("")
+			continue
+		}
+		g.p("func (c *Client) %v%v(%v) (%v, error) {", id, v.suffix, strings.Join(args, ", "), v.returnType)
+		g.p("resp, err := c.do(ctx, %q, %v, %v, %v, %q)", method, urlPath, query, requestBody, v.accept)
+		g.p("if err != nil {")
+		g.p("return nil, err")
+		g.p("}")
+		if v.raw {
+			g.p("return resp, nil")
+		} else if strings.HasPrefix(v.returnType, "[]") || strings.HasPrefix(v.returnType, "map[") || v.returnType == "json.RawMessage" {
+			g.p("var result %v", v.returnType)
+			g.p("if err := decode(resp, &result); err != nil {")
+			g.p("return nil, err")
+			g.p("}")
+			g.p("return result, nil")
+		} else {
+			g.p("result := &%v{}", strings.TrimPrefix(v.returnType, "*"))
+			g.p("if err := decode(resp, result); err != nil {")
+			g.p("return nil, err")
+			g.p("}")
+			g.p("return result, nil")
+		}
+		g.p("}")
+		g.p("")
+	}
+}
+
+func main() {
+	specPath := flag.String("spec", "../openapi.json", "OpenAPI spec to generate from")
+	out := flag.String("out", "api.go", "File to write")
+	flag.Parse()
+
+	f, err := os.Open(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	v, err := parse(json.NewDecoder(f))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	g := &generator{spec: v.(*object), imports: map[string]bool{}}
+	g.schemas()
+	g.operations()
+	body := g.buf.String()
+
+	var imports []string
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+
+	g.buf.Reset()
+	g.p("// Code generated by gen.go from openapi.json; DO NOT EDIT.")
+	g.p("")
+	g.p("package client")
+	g.p("")
+	g.p("import (")
+	for _, imp := range imports {
+		g.p("%q", imp)
+	}
+	g.p(")")
+	g.p("")
+	g.buf.WriteString(body)
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		os.WriteFile(*out, g.buf.Bytes(), 0644)
+		log.Fatalf("generated code doesn't format: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/ralreegorganon/ino"
+)
+
+// alertsink stands in for a webhook receiver, checking the signature on
+// every alert it's sent and logging what came in. Pointing a rule at it is
+// an easy way to see what the rule fires on.
+func alertsink(args []string) {
+	fs := flag.NewFlagSet("alertsink", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8990", "Address to listen on")
+	secret := fs.String("secret", os.Getenv("INO_ALERT_SECRET"), "Rule secret to check signatures with (default: don't check them)")
+	fail := fs.Int("fail", 0, "Respond 500 to this many webhooks before accepting any, to try out retries")
+	fs.Parse(args)
+
+	var failures atomic.Int64
+	failures.Store(int64(*fail))
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		delivery := r.Header.Get("X-Ino-Delivery")
+		if *secret != "" {
+			if err := ino.VerifyWebhook(*secret, r.Header.Get("X-Ino-Signature"), body, time.Now()); err != nil {
+				slog.Warn("Rejected alert", "delivery", delivery, slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if left := failures.Add(-1); left >= 0 {
+			slog.Info("Failing alert on purpose", "delivery", delivery, "left", left)
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+
+		slog.Info("Received alert", "delivery", delivery, "payload", string(body))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	slog.Info("alertsink listening", "address", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "alertsink:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ralreegorganon/ino"
+)
+
+// apikey manages the keys the API accepts.
+func apikey(args []string) {
+	if len(args) == 0 {
+		apikeyUsage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		apikeyCreate(args[1:])
+	case "revoke":
+		apikeyRevoke(args[1:])
+	case "list":
+		apikeyList(args[1:])
+	default:
+		apikeyUsage()
+		os.Exit(2)
+	}
+}
+
+func apikeyUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s apikey create|revoke|list\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "  create -name NAME [-role read|admin]  create a key and print it")
+	fmt.Fprintln(flag.CommandLine.Output(), "  revoke ID                            stop accepting a key")
+	fmt.Fprintln(flag.CommandLine.Output(), "  list                                 list keys and their usage")
+}
+
+func apikeyCreate(args []string) {
+	fs := flag.NewFlagSet("apikey create", flag.ExitOnError)
+	name := fs.String("name", "", "What the key is for")
+	role := fs.String("role", ino.APIKeyRead, "Role to grant, read or admin")
+	fs.Parse(args)
+
+	if *name == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db := openDB()
+	key, token, err := db.CreateAPIKey(*name, *role)
+	if err != nil {
+		slog.Error("Couldn't create API key", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Created %v key %v (%v). It won't be shown again.\n", key.Role, key.APIKeyID, key.Name)
+	fmt.Println(token)
+}
+
+func apikeyRevoke(args []string) {
+	fs := flag.NewFlagSet("apikey revoke", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		apikeyUsage()
+		os.Exit(2)
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		slog.Error("Invalid API key id", "id", fs.Arg(0))
+		os.Exit(2)
+	}
+
+	db := openDB()
+	key, err := db.RevokeAPIKey(id)
+	if err != nil {
+		slog.Error("Couldn't revoke API key, it may not exist or already be revoked", "id", id, slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	fmt.Printf("Revoked key %v (%v)\n", key.APIKeyID, key.Name)
+}
+
+func apikeyList(args []string) {
+	fs := flag.NewFlagSet("apikey list", flag.ExitOnError)
+	fs.Parse(args)
+
+	db := openDB()
+	keys, err := db.GetAPIKeys()
+	if err != nil {
+		slog.Error("Couldn't list API keys", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tROLE\tREQUESTS\tLAST USED\tCREATED\tREVOKED")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			k.APIKeyID, k.Name, k.Prefix, k.Role, k.RequestCount,
+			formatTime(k.LastUsedAt.Ptr()), k.CreatedAt.Format(time.RFC3339), formatTime(k.RevokedAt.Ptr()))
+	}
+	tw.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ralreegorganon/ino"
+)
+
+func archive(args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	dir := fs.String("dir", os.Getenv("INO_ARCHIVE_DIR"), "Directory to write archive files beneath")
+	olderThan := fs.Duration("older-than", envDuration("INO_ARCHIVE_AFTER", 30*24*time.Hour), "Archive days older than this")
+	purge := fs.Bool("purge", envBool("INO_ARCHIVE_PURGE", false), "Delete archived rows from the database")
+	fs.Parse(args)
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "archive: -dir or INO_ARCHIVE_DIR is required")
+		os.Exit(2)
+	}
+
+	db := openDB()
+	a := ino.NewArchiver(db, &ino.ArchiverOptions{
+		Dir:       *dir,
+		OlderThan: *olderThan,
+		Purge:     *purge,
+	})
+
+	archives, err := a.Run()
+	for _, x := range archives {
+		fmt.Printf("%s\t%s\t%d rows\t%s\n", x.Day.Format(time.DateOnly), x.Kind, x.RowCount, x.Path)
+	}
+	if err != nil {
+		slog.Error("Couldn't archive", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func importArchive(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ino import file...")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db := openDB()
+	for _, path := range fs.Args() {
+		n, err := db.ImportArchive(path)
+		if err != nil {
+			slog.Error("Couldn't import archive", "path", path, slog.Any("error", err))
+			os.Exit(1)
+		}
+		fmt.Printf("%s\t%d rows\n", path, n)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/ralreegorganon/ino"
+)
+
+// contract requests every operation in the OpenAPI spec from a running
+// server and checks that the responses match what the spec says they'll be.
+func contract(args []string) {
+	fs := flag.NewFlagSet("contract", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8989", "Base URL of the server to check")
+	mmsi := fs.Int64("mmsi", 0, "MMSI to use for vessel routes (default: the first vessel listed)")
+	feedID := fs.Int64("feed", 1, "Feed id to use for feed routes")
+	key := fs.String("key", os.Getenv("INO_API_KEY"), "API key to send, for servers that require one")
+	fs.Parse(args)
+
+	header := http.Header{}
+	if *key != "" {
+		header.Set("Authorization", "Bearer "+*key)
+	}
+
+	spec, err := ino.LoadOpenAPI()
+	if err != nil {
+		slog.Error("Couldn't load OpenAPI spec", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	if *mmsi == 0 {
+		*mmsi, err = firstVessel(*baseURL, header)
+		if err != nil {
+			slog.Error("Couldn't find a vessel to check with, pass -mmsi", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	pathValues := ino.ContractPathValues(*mmsi, *feedID)
+
+	failures := 0
+	for _, op := range spec.Operations() {
+		if op.Skip() || op.Method != http.MethodGet {
+			continue
+		}
+
+		u := spec.ExampleURL(op, *baseURL, pathValues)
+		_, err := spec.CheckContract(http.DefaultClient, op, u, header)
+		if err != nil {
+			failures++
+			fmt.Printf("FAIL\t%v\n", err)
+			continue
+		}
+		fmt.Printf("ok\t%v %v\n", op.Method, u)
+	}
+
+	if failures > 0 {
+		fmt.Printf("%d operations don't match the spec\n", failures)
+		os.Exit(1)
+	}
+}
+
+func get(u string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	return http.DefaultClient.Do(req)
+}
+
+func firstVessel(baseURL string, header http.Header) (int64, error) {
+	resp, err := get(baseURL+"/api/vessels/near?lat=0&lon=0&limit=1", header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var vessels []struct {
+		MMSI int64 `json:"mmsi"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&vessels); err != nil {
+		return 0, err
+	}
+	if len(vessels) == 0 {
+		return 0, fmt.Errorf("no vessels")
+	}
+	return vessels[0].MMSI, nil
+}
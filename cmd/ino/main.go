@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ralreegorganon/ino"
@@ -14,6 +16,7 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var version = flag.Bool("version", false, "Print version")
@@ -25,6 +28,7 @@ func init() {
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
 	if *version {
@@ -32,9 +36,49 @@ func main() {
 		return
 	}
 
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
+	args := flag.Args()
+	if len(args) == 0 {
+		serve()
+		return
+	}
+
+	switch args[0] {
+	case "serve":
+		serve()
+	case "archive":
+		archive(args[1:])
+	case "import":
+		importArchive(args[1:])
+	case "contract":
+		contract(args[1:])
+	case "apikey":
+		apikey(args[1:])
+	case "alertsink":
+		alertsink(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+	fmt.Fprintln(flag.CommandLine.Output(), "  serve     decode feeds and serve the API (default)")
+	fmt.Fprintln(flag.CommandLine.Output(), "  archive   export old packets and messages to disk")
+	fmt.Fprintln(flag.CommandLine.Output(), "  import    load archive files back into the database")
+	fmt.Fprintln(flag.CommandLine.Output(), "  contract  check a running server against its OpenAPI spec")
+	fmt.Fprintln(flag.CommandLine.Output(), "  apikey    create, revoke and list API keys")
+	fmt.Fprintln(flag.CommandLine.Output(), "  alertsink receive and check alert webhooks, for trying rules out")
+	fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// schemaVersion is the migration openDB brought the database up to.
+var schemaVersion uint
 
+// openDB connects to the database and brings its schema up to date.
+func openDB() *ino.DB {
 	connectionString := os.Getenv("INO_CONNECTION_STRING")
 	var db ino.DB
 	if err := db.Open(connectionString); err != nil {
@@ -59,13 +103,112 @@ func main() {
 		}
 	}
 
-	mm, err := ino.NewMonstahManager(&db)
+	if v, _, err := g.Version(); err == nil {
+		schemaVersion = v
+	}
+
+	return &db
+}
+
+func serve() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	db := openDB()
+
+	zones, err := ino.NewZoneTracker(db, &ino.ZoneOptions{
+		DwellAfter: envDuration("INO_ZONE_DWELL", 30*time.Minute),
+	})
+	if err != nil {
+		slog.Error("Couldn't load zones", slog.Any("error", err))
+		os.Exit(1)
+	}
+	db.Zones = zones
+
+	alerts, err := ino.NewAlertEngine(db, zones, &ino.AlertOptions{
+		MaxAttempts: envInt("INO_ALERT_MAX_ATTEMPTS", 8),
+		Backoff:     envDuration("INO_ALERT_BACKOFF", 10*time.Second),
+		MaxBackoff:  envDuration("INO_ALERT_BACKOFF_MAX", time.Hour),
+		Timeout:     envDuration("INO_ALERT_TIMEOUT", 10*time.Second),
+	})
+	if err != nil {
+		slog.Error("Couldn't load alert rules", slog.Any("error", err))
+		os.Exit(1)
+	}
+	db.Alerts = alerts
+	alerts.Start()
+
+	mm, err := ino.NewMonstahManager(db, &ino.MonstahOptions{
+		DedupWindow:     envDuration("INO_DEDUP_WINDOW", 10*time.Second),
+		FragmentTimeout: envDuration("INO_FRAGMENT_TIMEOUT", 2*time.Second),
+	})
 	if err != nil {
 		slog.Error("Couldn't create feed manager", slog.Any("error", err))
 		os.Exit(1)
 	}
 
-	server := ino.NewHTTPServer(&db)
+	prometheus.MustRegister(mm)
+
+	var archiver *ino.Archiver
+	if dir := os.Getenv("INO_ARCHIVE_DIR"); dir != "" {
+		archiver = ino.NewArchiver(db, &ino.ArchiverOptions{
+			Dir:       dir,
+			OlderThan: envDuration("INO_ARCHIVE_AFTER", 30*24*time.Hour),
+			Purge:     envBool("INO_ARCHIVE_PURGE", false),
+		})
+		archiver.Start(envDuration("INO_ARCHIVE_INTERVAL", 24*time.Hour))
+	}
+
+	rollup := ino.NewRollup(db, &ino.RollupOptions{
+		MinuteRetention: envDuration("INO_ROLLUP_MINUTE_RETENTION", 7*24*time.Hour),
+	})
+	rollup.Start(envDuration("INO_ROLLUP_INTERVAL", time.Minute))
+
+	voyages := ino.NewVoyageSegmenter(db, &ino.VoyageOptions{
+		PortTag:     envString("INO_PORT_TAG", "port"),
+		StopSpeed:   envFloat("INO_VOYAGE_STOP_SPEED", 0.5),
+		DepartSpeed: envFloat("INO_VOYAGE_DEPART_SPEED", 2),
+		MinStop:     envDuration("INO_VOYAGE_MIN_STOP", 30*time.Minute),
+	})
+	voyages.Start(envDuration("INO_VOYAGE_INTERVAL", time.Minute))
+
+	var coverage *ino.CoverageMapper
+	if interval := envDuration("INO_COVERAGE_INTERVAL", time.Hour); interval > 0 {
+		coverage = ino.NewCoverageMapper(db, &ino.CoverageOptions{
+			Windows:     envDurations("INO_COVERAGE_WINDOWS", []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}),
+			SectorWidth: envFloat("INO_COVERAGE_SECTOR", 10),
+			HexSize:     envFloat("INO_COVERAGE_HEX_SIZE", 5000),
+		})
+		coverage.Start(interval)
+	}
+
+	auth := ino.NewAuthenticator(db, &ino.AuthOptions{
+		Required: envBool("INO_REQUIRE_API_KEY", false),
+		CacheTTL: envDuration("INO_API_KEY_CACHE_TTL", time.Minute),
+	})
+	auth.Start(envDuration("INO_API_KEY_USAGE_INTERVAL", 30*time.Second))
+
+	server := ino.NewHTTPServer(db, mm)
+	server.Auth = auth
+	server.Coverage = coverage
+	server.Zones = zones
+	server.Alerts = alerts
+	server.AllowedOrigins = envList("INO_CORS_ORIGINS")
+	server.TrustProxy = envBool("INO_TRUST_PROXY", false)
+	server.Health = ino.HealthOptions{
+		MinFeeds:      envInt("INO_READY_MIN_FEEDS", 1),
+		Staleness:     envDuration("INO_READY_STALENESS", 5*time.Minute),
+		SchemaVersion: schemaVersion,
+	}
+	if envBool("INO_CACHE", true) {
+		server.Cache = ino.NewResponseCache()
+	}
+	if rate := envFloat("INO_RATE_LIMIT", 20); rate > 0 {
+		server.RateLimit = ino.NewRateLimiter(&ino.RateLimitOptions{
+			Rate:  rate,
+			Burst: envInt("INO_RATE_BURST", 60),
+		})
+	}
 	router, err := ino.CreateRouter(server)
 	if err != nil {
 		slog.Error("Couldn't create router", slog.Any("error", err))
@@ -78,5 +221,104 @@ func main() {
 	slog.Info("ino web server started", "address", u)
 
 	<-interrupt
+	if archiver != nil {
+		archiver.Shutdown()
+	}
+	if coverage != nil {
+		coverage.Shutdown()
+	}
+	rollup.Shutdown()
+	voyages.Shutdown()
+	auth.Shutdown()
 	mm.Shutdown()
+	zones.Shutdown()
+	alerts.Shutdown()
+}
+
+func envString(name string, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Error("Couldn't parse duration", "name", name, "value", v, slog.Any("error", err))
+		os.Exit(1)
+	}
+	return d
+}
+
+// envDurations reads a comma separated list of durations.
+func envDurations(name string, fallback []time.Duration) []time.Duration {
+	list := envList(name)
+	if list == nil {
+		return fallback
+	}
+	durations := make([]time.Duration, len(list))
+	for i, v := range list {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			slog.Error("Couldn't parse duration", "name", name, "value", v, slog.Any("error", err))
+			os.Exit(1)
+		}
+		durations[i] = d
+	}
+	return durations
+}
+
+func envFloat(name string, fallback float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		slog.Error("Couldn't parse number", "name", name, "value", v, slog.Any("error", err))
+		os.Exit(1)
+	}
+	return f
+}
+
+func envInt(name string, fallback int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Error("Couldn't parse integer", "name", name, "value", v, slog.Any("error", err))
+		os.Exit(1)
+	}
+	return i
+}
+
+// envList splits a comma separated variable, returning nil when it's unset.
+func envList(name string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func envBool(name string, fallback bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Error("Couldn't parse boolean", "name", name, "value", v, slog.Any("error", err))
+		os.Exit(1)
+	}
+	return b
 }
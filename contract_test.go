@@ -0,0 +1,89 @@
+package ino
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestContractWithoutDatabase checks the responses that are decided before
+// the database is asked anything, errors mostly, against the spec.
+func TestContractWithoutDatabase(t *testing.T) {
+	spec, srv := newContractServer(t, &HTTPServer{})
+
+	cases := []struct {
+		operationID string
+		path        string
+		status      int
+	}{
+		{"GetOpenAPI", "/api/openapi.json", http.StatusOK},
+		{"GetVessels", "/api/vessels?polygon=" + url.QueryEscape("POINT(1 2)"), http.StatusBadRequest},
+		{"GetVessels", "/api/vessels?class=C", http.StatusBadRequest},
+		{"GetVesselsNear", "/api/vessels/near?lat=91&lon=0", http.StatusBadRequest},
+		{"GetVesselsNear", "/api/vessels/near?lat=0&lon=0&f=shapefile", http.StatusBadRequest},
+		{"GetVoyagesForVessel", "/api/vessels/1/voyages?kind=berth", http.StatusBadRequest},
+		{"GetAlertRules", "/api/alerts/rules", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		op := contractOperation(t, spec, c.operationID)
+		status, err := spec.CheckContract(srv.Client(), op, srv.URL+c.path, nil)
+		if err != nil {
+			t.Errorf("%v: %v", c.path, err)
+			continue
+		}
+		if status != c.status {
+			t.Errorf("%v: status %v, want %v", c.path, status, c.status)
+		}
+	}
+}
+
+// TestContract requests every operation in the spec that can be, the way
+// ino contract does against a running server, and checks the responses
+// match it.
+func TestContract(t *testing.T) {
+	db := openTestDB(t)
+	server := NewHTTPServer(db, &MonstahManager{DB: db, Hub: NewHub()})
+	spec, srv := newContractServer(t, server)
+
+	// Without any vessels, mmsi 0 checks the not found responses instead.
+	var mmsi int64
+	db.QueryRow("select mmsi from vessel order by updated_at desc limit 1").Scan(&mmsi)
+	pathValues := ContractPathValues(mmsi, benchFeedID)
+
+	for _, op := range spec.Operations() {
+		if op.Skip() || op.Method != http.MethodGet {
+			continue
+		}
+		u := spec.ExampleURL(op, srv.URL, pathValues)
+		if _, err := spec.CheckContract(srv.Client(), op, u, nil); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func newContractServer(t *testing.T, server *HTTPServer) (*OpenAPI, *httptest.Server) {
+	t.Helper()
+	spec, err := LoadOpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := CreateRouter(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return spec, srv
+}
+
+func contractOperation(t *testing.T, spec *OpenAPI, operationID string) OpenAPIOperation {
+	t.Helper()
+	for _, op := range spec.Operations() {
+		if op.OperationID == operationID {
+			return op
+		}
+	}
+	t.Fatalf("no operation %v in the spec", operationID)
+	return OpenAPIOperation{}
+}
@@ -0,0 +1,435 @@
+package ino
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// coverageConcavity is how tightly hulls wrap the positions a feed heard,
+// from 0 hugging every point to 1 being the convex hull.
+const coverageConcavity = 0.3
+
+type CoverageOptions struct {
+	// Windows are the periods coverage is computed over, which clients can
+	// pick between and compare.
+	Windows []time.Duration
+	// SectorWidth is the bearing sector, in degrees, that the maximum range
+	// is taken over.
+	SectorWidth float64
+	// HexSize is the size of the density hexagons, in web mercator metres.
+	HexSize float64
+}
+
+// CoverageMapper periodically works out how far each feed's receiver
+// reaches from the positions it heard, so coverage maps don't have to scan
+// receptions when they're requested.
+type CoverageMapper struct {
+	DB      *DB
+	options CoverageOptions
+	job     *periodicJob
+}
+
+func NewCoverageMapper(db *DB, options *CoverageOptions) *CoverageMapper {
+	c := &CoverageMapper{
+		DB:      db,
+		options: *options,
+		job:     newPeriodicJob(),
+	}
+	return c
+}
+
+// Start refreshes coverage every interval until Shutdown is called.
+func (c *CoverageMapper) Start(interval time.Duration) {
+	c.job.start(interval, "Couldn't refresh coverage", c.Run)
+}
+
+func (c *CoverageMapper) Shutdown() {
+	c.job.stop()
+}
+
+// Windows are the periods coverage is available for.
+func (c *CoverageMapper) Windows() []time.Duration {
+	return c.options.Windows
+}
+
+// Run refreshes every active feed's coverage over every window.
+func (c *CoverageMapper) Run() error {
+	feeds, err := c.DB.GetFeeds()
+	if err != nil {
+		return err
+	}
+	for _, feed := range feeds {
+		if !feed.Active {
+			continue
+		}
+		for _, window := range c.options.Windows {
+			start := time.Now()
+			if err := c.DB.RefreshFeedCoverage(int(feed.FeedID), window, &c.options); err != nil {
+				return err
+			}
+			slog.Debug("Refreshed coverage", "feedId", feed.FeedID, "window", window, "took", time.Since(start))
+		}
+	}
+	return nil
+}
+
+// RefreshFeedCoverage recomputes a feed's coverage over a window from the
+// position reports it heard. Ranges are measured from the receiver's
+// location, or the middle of what it heard when that isn't known.
+func (db *DB) RefreshFeedCoverage(feedID int, window time.Duration, options *CoverageOptions) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seconds := int(window.Seconds())
+
+	// Positions are rounded to about 100m, which keeps the range and density
+	// work proportional to the area covered rather than the traffic.
+	_, err = tx.Exec(`
+		create temporary table coverage_point on commit drop as
+		select
+			st_setsrid(st_makepoint(longitude, latitude), 4326) geom,
+			case
+				when abs(latitude) < 85 then st_transform(st_setsrid(st_makepoint(longitude, latitude), 4326), 3857)
+			end mercator,
+			receptions
+		from
+		(
+			select
+				round((m.message->>'Latitude')::numeric, 3)::double precision latitude,
+				round((m.message->>'Longitude')::numeric, 3)::double precision longitude,
+				count(1) receptions
+			from
+				message_reception r
+				join message m on m.message_id = r.message_id
+			where
+				r.feed_id = $1
+				and r.created_at > now() - make_interval(secs => $2)
+				and m.type in (1, 2, 3, 18, 19)
+			group by
+				1,
+				2
+		) p
+		where
+			latitude between -90 and 90
+			and longitude between -180 and 180
+	`, feedID, seconds)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("delete from feed_coverage where feed_id = $1 and window_seconds = $2", feedID, seconds)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		with
+		origin as
+		(
+			select
+				coalesce(
+					st_setsrid(st_makepoint(f.longitude, f.latitude), 4326),
+					(select st_centroid(st_collect(geom)) from coverage_point)
+				) geom,
+				f.latitude is null or f.longitude is null estimated
+			from
+				feed f
+			where
+				f.feed_id = $1
+		),
+		ranged as
+		(
+			select
+				floor(degrees(st_azimuth(o.geom::geography, p.geom::geography)) / $3::double precision)::integer sector,
+				st_distance(o.geom::geography, p.geom::geography) distance
+			from
+				coverage_point p,
+				origin o
+			where
+				not st_equals(p.geom, o.geom)
+		),
+		sectors as
+		(
+			select
+				s sector,
+				coalesce(max(r.distance), 0) distance
+			from
+				generate_series(0, ceil(360 / $3::double precision)::integer - 1) s
+				left join ranged r on r.sector = s
+			group by
+				s
+		),
+		outline as
+		(
+			select
+				st_makevalid(st_makepolygon(st_makeline(
+					array[o.geom] || array_agg(e.point order by s.sector, e.edge) || array[o.geom]
+				))) geom
+			from
+				origin o,
+				sectors s,
+				lateral (
+					values
+						(0, st_project(o.geom::geography, s.distance, radians(s.sector * $3::double precision))::geometry),
+						(1, st_project(o.geom::geography, s.distance, radians(least((s.sector + 1) * $3::double precision, 360)))::geometry)
+				) e (edge, point)
+			where
+				exists (select 1 from ranged)
+			group by
+				o.geom
+		)
+		insert into feed_coverage
+		(feed_id, window_seconds, positions, max_range, origin, origin_estimated, hull, sectors)
+		select
+			$1,
+			$2,
+			(select coalesce(sum(receptions), 0) from coverage_point),
+			(select max(distance) from ranged),
+			o.geom,
+			o.estimated,
+			(select st_concavehull(st_collect(geom), $4) from coverage_point),
+			(select geom from outline)
+		from
+			origin o
+	`, feedID, seconds, options.SectorWidth, coverageConcavity)
+	if err != nil {
+		return err
+	}
+
+	// Each point is binned into the hexagons of the grid that cover it, which
+	// lines up across points since the grid is anchored at the projection's
+	// origin.
+	_, err = tx.Exec(`
+		insert into feed_coverage_hex
+		(feed_id, window_seconds, hex, receptions)
+		select
+			$1,
+			$2,
+			st_transform(h.geom, 4326),
+			sum(p.receptions)
+		from
+			coverage_point p
+			cross join lateral st_hexagongrid($3, p.mercator) h
+		where
+			p.mercator is not null
+			and st_intersects(h.geom, p.mercator)
+		group by
+			h.i,
+			h.j,
+			h.geom
+	`, feedID, seconds, options.HexSize)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetFeedCoverageGeojson renders a feed's coverage over a window as a
+// FeatureCollection. With a comparison window it also has that window's
+// coverage and the areas gained and lost between them.
+func (db *DB) GetFeedCoverageGeojson(feedID int, window time.Duration, compare time.Duration) ([]byte, error) {
+	seconds := int(window.Seconds())
+	compareSeconds := int(compare.Seconds())
+
+	var found int
+	err := db.QueryRow(`
+		select count(1) from feed_coverage where feed_id = $1 and window_seconds in ($2, $3)
+	`, feedID, seconds, compareSeconds).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+	if found == 0 || (compare != 0 && compare != window && found < 2) {
+		return nil, sql.ErrNoRows
+	}
+
+	var json []byte
+	err = db.QueryRow(`
+		with
+		windows as
+		(
+			select
+				c.*,
+				case c.window_seconds when $2 then $4::text else $5::text end label,
+				case c.window_seconds when $2 then 0 else 1 end ord
+			from
+				feed_coverage c
+			where
+				c.feed_id = $1
+				and c.window_seconds in ($2, $3)
+		),
+		features as
+		(
+			select
+				w.ord,
+				0 kind_ord,
+				json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(w.sectors)::json,
+					'properties', json_build_object(
+						'kind', 'range',
+						'window', w.label,
+						'positions', w.positions,
+						'maxRange', w.max_range,
+						'refreshedAt', w.refreshed_at
+					)
+				) feature
+			from
+				windows w
+			where
+				w.sectors is not null
+			union all
+			select
+				w.ord,
+				1,
+				json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(w.hull)::json,
+					'properties', json_build_object('kind', 'hull', 'window', w.label)
+				)
+			from
+				windows w
+			where
+				w.hull is not null
+			union all
+			select
+				w.ord,
+				2,
+				json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(w.origin)::json,
+					'properties', json_build_object('kind', 'origin', 'window', w.label, 'estimated', w.origin_estimated)
+				)
+			from
+				windows w
+			where
+				w.origin is not null
+			union all
+			select
+				w.ord,
+				3,
+				json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(h.hex)::json,
+					'properties', json_build_object('kind', 'density', 'window', w.label, 'receptions', h.receptions)
+				)
+			from
+				windows w
+				join feed_coverage_hex h on h.feed_id = w.feed_id and h.window_seconds = w.window_seconds
+			union all
+			select
+				2,
+				d.kind_ord,
+				json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(d.geom)::json,
+					'properties', json_build_object('kind', d.kind, 'window', $4::text, 'compare', $5::text)
+				)
+			from
+				windows a,
+				windows b,
+				lateral (
+					values
+						(0, 'gained', st_difference(a.hull, b.hull)),
+						(1, 'lost', st_difference(b.hull, a.hull))
+				) d (kind_ord, kind, geom)
+			where
+				a.ord = 0
+				and b.ord = 1
+				and not st_isempty(d.geom)
+		)
+		select
+			json_build_object(
+				'type', 'FeatureCollection',
+				'features', coalesce(json_agg(feature order by ord, kind_ord), '[]')
+			)
+		from
+			features
+	`, feedID, seconds, compareSeconds, durationLabel(window), durationLabel(compare)).Scan(&json)
+	if err != nil {
+		return nil, err
+	}
+	return json, nil
+}
+
+// durationLabel writes a duration without the zero minutes and seconds
+// String leaves on, so 24h rather than 24h0m0s.
+func durationLabel(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// coverageWindow reads a window parameter, which has to be one coverage is
+// computed over.
+func coverageWindow(v string, windows []time.Duration) (time.Duration, error) {
+	window, err := time.ParseDuration(v)
+	if err == nil {
+		for _, w := range windows {
+			if w == window {
+				return window, nil
+			}
+		}
+	}
+	available := make([]string, len(windows))
+	for i, w := range windows {
+		available[i] = durationLabel(w)
+	}
+	return 0, badRequestf("ino: invalid window '%v', must be one of %v", v, strings.Join(available, ", "))
+}
+
+func (s *HTTPServer) GetFeedCoverage(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if s.Coverage == nil || len(s.Coverage.Windows()) == 0 {
+		return notFoundf("ino: coverage isn't being computed")
+	}
+	windows := s.Coverage.Windows()
+
+	query := r.URL.Query()
+	window := windows[0]
+	if v := query.Get("window"); v != "" {
+		if window, err = coverageWindow(v, windows); err != nil {
+			return err
+		}
+	}
+	var compare time.Duration
+	if v := query.Get("compare"); v != "" {
+		if compare, err = coverageWindow(v, windows); err != nil {
+			return err
+		}
+		if compare == window {
+			return badRequestf("ino: compare has to be a different window to %v", durationLabel(window))
+		}
+	}
+
+	if _, err := s.DB.GetFeed(feedID); err != nil {
+		return err
+	}
+
+	json, err := s.DB.GetFeedCoverageGeojson(feedID, window, compare)
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFoundf("ino: coverage for feed %v hasn't been computed yet", feedID)
+	}
+	if err != nil {
+		return err
+	}
+
+	writeGeoJSON(w, http.StatusOK, json)
+	return nil
+}
@@ -2,8 +2,10 @@ package ino
 
 import (
 	"errors"
-	"fmt"
+	"sync"
+	"time"
 
+	"github.com/guregu/null/v5"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/ralreegorganon/nmeaais"
@@ -11,6 +13,11 @@ import (
 
 type DB struct {
 	*sqlx.DB
+	stmts sync.Map
+	// Zones, when set, is told about every position that's stored.
+	Zones *ZoneTracker
+	// Alerts, when set, is told about every vessel update that's stored.
+	Alerts *AlertEngine
 }
 
 func (db *DB) Open(connectionString string) error {
@@ -22,23 +29,80 @@ func (db *DB) Open(connectionString string) error {
 	return nil
 }
 
+// prepared returns a prepared statement for query, preparing it the first
+// time it's seen and reusing it on every call after that.
+func (db *DB) prepared(query string) (*sqlx.Stmt, error) {
+	if stmt, ok := db.stmts.Load(query); ok {
+		return stmt.(*sqlx.Stmt), nil
+	}
+
+	stmt, err := db.Preparex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, loaded := db.stmts.LoadOrStore(query, stmt); loaded {
+		stmt.Close()
+		return existing.(*sqlx.Stmt), nil
+	}
+	return stmt, nil
+}
+
 func (db *DB) AddPacket(raw string, feedID int) error {
-	_, err := db.Exec("insert into packet (raw, feed_id) values ($1, $2)", raw, feedID)
+	defer observeDBWrite("packet", time.Now())
+
+	stmt, err := db.prepared("insert into packet (raw, feed_id) values ($1, $2)")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(raw, feedID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) AddMessage(mmsi int64, messageType int64, message []byte, raw []byte, feedID int) error {
-	_, err := db.Exec("insert into message (mmsi, type, message, raw, feed_id) values ($1, $2, $3, $4, $5)", mmsi, messageType, message, raw, feedID)
+func (db *DB) AddMessage(mmsi int64, messageType int64, message []byte, raw []byte, feedID int) (int64, error) {
+	defer observeDBWrite("message", time.Now())
+
+	stmt, err := db.prepared(`
+		with m as
+		(
+			insert into message (mmsi, type, message, raw, feed_id) values ($1, $2, $3, $4, $5)
+			returning message_id, feed_id, created_at
+		)
+		insert into message_reception (message_id, feed_id, created_at)
+		select message_id, feed_id, created_at from m
+		returning message_id
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var messageID int64
+	err = stmt.QueryRow(mmsi, messageType, message, raw, feedID).Scan(&messageID)
+	if err != nil {
+		return 0, err
+	}
+	return messageID, nil
+}
+
+func (db *DB) AddMessageReception(messageID int64, feedID int) error {
+	defer observeDBWrite("message_reception", time.Now())
+
+	stmt, err := db.prepared("insert into message_reception (message_id, feed_id) values ($1, $2)")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(messageID, feedID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) GetVessels() ([]*Vessel, error) {
+func (db *DB) GetVessels(filter *VesselFilter) ([]*Vessel, error) {
+	where, args := filter.where()
 	vessels := []*Vessel{}
 	err := db.Select(&vessels, `
 		select
@@ -56,19 +120,52 @@ func (db *DB) GetVessels() ([]*Vessel, error) {
 			course_over_ground,
 			navigation_status,
 			destination,
+			imo_number,
+			class,
+			feed_id,
 			updated_at
 		from
 			vessel
-	`)
+	`+where, args...)
 	if err != nil {
 		return nil, err
 	}
 	return vessels, nil
 }
 
-func (db *DB) GetVesselsGeojson() ([]byte, error) {
+func (db *DB) GetVesselsGeojson(filter *VesselFilter) ([]byte, error) {
+	where, args := filter.where()
 	var geojson []byte
-	err := db.QueryRow("select geojson from vessel_geojson").Scan(&geojson)
+	err := db.QueryRow(`
+		select
+			json_build_object(
+				'type', 'FeatureCollection',
+				'features', coalesce(json_agg(json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(the_geog)::json,
+					'properties', json_build_object(
+						'mmsi', mmsi,
+						'vesselName', vessel_name,
+						'callSign', call_sign,
+						'shipType', ship_type,
+						'length', length,
+						'breadth', breadth,
+						'draught', draught,
+						'speedOverGround', speed_over_ground,
+						'trueHeading', true_heading,
+						'courseOverGround', course_over_ground,
+						'navigationStatus', navigation_status,
+						'destination', destination,
+						'imoNumber', imo_number,
+						'class', class,
+						'feedId', feed_id,
+						'updatedAt', updated_at
+					)
+				)), '[]')
+			) geojson
+		from
+			vessel
+	`+where, args...).Scan(&geojson)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +190,9 @@ func (db *DB) GetVessel(mmsi int) (*Vessel, error) {
 			course_over_ground,
 			navigation_status,
 			destination,
+			imo_number,
+			class,
+			feed_id,
 			updated_at
 		from
 			vessel
@@ -105,10 +205,23 @@ func (db *DB) GetVessel(mmsi int) (*Vessel, error) {
 	return vessel, nil
 }
 
-func (db *DB) GetPositionsForVessel(mmsi int) ([]*Position, error) {
+func (db *DB) GetPositionsForVessel(mmsi int, filter *TrackFilter) ([]*Position, error) {
+	var cursorTime null.Time
+	var cursorID int64
+	if filter.Cursor != nil {
+		cursorTime = null.TimeFrom(filter.Cursor.CreatedAt)
+		cursorID = filter.Cursor.PositionID
+	}
+
+	var limit null.Int
+	if filter.Limit > 0 {
+		limit = null.IntFrom(int64(filter.Limit))
+	}
+
 	positions := []*Position{}
 	err := db.Select(&positions, `
 		select
+			position_id,
 			mmsi,
 			latitude,
 			longitude,
@@ -117,29 +230,103 @@ func (db *DB) GetPositionsForVessel(mmsi int) ([]*Position, error) {
 			position
 		where
 			mmsi = $1
-		order by created_at desc
-	`, mmsi)
+			and ($2::timestamptz is null or created_at >= $2)
+			and ($3::timestamptz is null or created_at < $3)
+			and ($4::timestamptz is null or (created_at, position_id) < ($4, $5))
+		order by created_at desc, position_id desc
+		limit $6
+	`, mmsi, filter.From, filter.To, cursorTime, cursorID, limit)
 	if err != nil {
 		return nil, err
 	}
 	return positions, nil
 }
 
-func (db *DB) GetPositionsForVesselGeojson(mmsi int) ([]byte, error) {
+// GetPositionsForVesselGeojson returns a vessel's track as a FeatureCollection
+// of line segments, starting a new segment wherever consecutive positions are
+// further apart than the filter's gap thresholds.
+func (db *DB) GetPositionsForVesselGeojson(mmsi int, filter *TrackFilter) ([]byte, error) {
 	var geojson []byte
-	err := db.QueryRow("select geojson from position_geojson where mmsi = $1", mmsi).Scan(&geojson)
+	err := db.QueryRow(`
+		with
+		positions as
+		(
+			select
+				the_geog,
+				created_at,
+				case
+					when $4::double precision > 0 and created_at - lag(created_at) over w > make_interval(secs => $4::double precision) then 1
+					when $5::double precision > 0 and ST_Distance(the_geog, lag(the_geog) over w) > $5::double precision then 1
+					else 0
+				end new_segment
+			from
+				position
+			where
+				mmsi = $1
+				and ($2::timestamptz is null or created_at >= $2)
+				and ($3::timestamptz is null or created_at < $3)
+			window w as (order by created_at, position_id)
+		),
+		numbered as
+		(
+			select
+				the_geog::geometry the_geom,
+				created_at,
+				sum(new_segment) over (order by created_at rows unbounded preceding) segment
+			from
+				positions
+		),
+		segments as
+		(
+			select
+				segment,
+				min(created_at) started_at,
+				max(created_at) ended_at,
+				count(1) points,
+				case
+					when count(1) = 1 then (array_agg(the_geom))[1]
+					else st_makeline(the_geom order by created_at)
+				end the_geom
+			from
+				numbered
+			group by
+				segment
+		)
+		select
+			json_build_object(
+				'type', 'FeatureCollection',
+				'features', coalesce(json_agg(json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(
+						case
+							when $6::double precision > 0 and points > 2 then ST_Transform(ST_SimplifyPreserveTopology(ST_Transform(ST_SetSRID(the_geom, 4326), 3857), $6::double precision), 4326)
+							else the_geom
+						end
+					)::json,
+					'properties', json_build_object(
+						'mmsi', $1::integer,
+						'segment', segment,
+						'startedAt', started_at,
+						'endedAt', ended_at,
+						'points', points
+					)
+				) order by segment), '[]')
+			) geojson
+		from
+			segments
+	`, mmsi, filter.From, filter.To, filter.Gap.Seconds(), filter.GapDistance, filter.Simplify).Scan(&geojson)
 	if err != nil {
 		return nil, err
 	}
 	return geojson, nil
 }
 
-func (db *DB) UpdateVesselFromPositionReportClassA(m *nmeaais.PositionReportClassA) error {
-	sql := fmt.Sprintf(`
+func (db *DB) UpdateVesselFromPositionReportClassA(m *nmeaais.PositionReportClassA, feedID int) error {
+	sql := `
 	insert into vessel
-	(mmsi, latitude, longitude, speed_over_ground, true_heading, course_over_ground, navigation_status, the_geog, updated_at)
+	(mmsi, latitude, longitude, speed_over_ground, true_heading, course_over_ground, navigation_status, class, feed_id, the_geog, updated_at)
 	values
-	($1, $2, $3, $4, $5, $6, $7, ST_GeographyFromText('SRID=4326;POINT(%[1]f %[2]f)'), now())
+	($1, $2, $3, $4, $5, $6, $7, 'A', $8, ST_SetSRID(ST_MakePoint($3, $2), 4326)::geography, now())
 	on conflict (mmsi)
 	do update set
 		latitude = EXCLUDED.latitude,
@@ -148,23 +335,29 @@ func (db *DB) UpdateVesselFromPositionReportClassA(m *nmeaais.PositionReportClas
 		true_heading = EXCLUDED.true_heading,
 		course_over_ground = EXCLUDED.course_over_ground,
 		navigation_status = EXCLUDED.navigation_status,
+		class = EXCLUDED.class,
+		feed_id = EXCLUDED.feed_id,
 		the_geog = EXCLUDED.the_geog,
 		updated_at = EXCLUDED.updated_at
-	`, m.Longitude, m.Latitude)
+	`
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Exec(sql, m.MMSI, m.Latitude, m.Longitude, m.SpeedOverGround, m.TrueHeading, m.CourseOverGround, m.NavigationStatus)
+	_, err = stmt.Exec(m.MMSI, m.Latitude, m.Longitude, m.SpeedOverGround, m.TrueHeading, m.CourseOverGround, m.NavigationStatus, feedID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) UpdateVesselFromStaticAndVoyageRelatedData(m *nmeaais.StaticAndVoyageRelatedData) error {
+func (db *DB) UpdateVesselFromStaticAndVoyageRelatedData(m *nmeaais.StaticAndVoyageRelatedData, feedID int) error {
 	sql := `
 	insert into vessel
-	(mmsi, vessel_name, call_sign, ship_type, length, breadth, draught, destination, updated_at)
+	(mmsi, vessel_name, call_sign, ship_type, length, breadth, draught, destination, imo_number, class, feed_id, updated_at)
 	values
-	($1, $2, $3, $4, $5, $6, $7, $8, now())
+	($1, $2, $3, $4, $5, $6, $7, $8, nullif($9, 0), 'A', $10, now())
 	on conflict (mmsi)
 	do update set
 		vessel_name = EXCLUDED.vessel_name,
@@ -174,21 +367,29 @@ func (db *DB) UpdateVesselFromStaticAndVoyageRelatedData(m *nmeaais.StaticAndVoy
 		breadth = EXCLUDED.breadth,
 		draught = EXCLUDED.draught,
 		destination = EXCLUDED.destination,
+		imo_number = coalesce(EXCLUDED.imo_number, vessel.imo_number),
+		class = EXCLUDED.class,
+		feed_id = EXCLUDED.feed_id,
 		updated_at = EXCLUDED.updated_at
 	`
-	_, err := db.Exec(sql, m.MMSI, m.VesselName, m.CallSign, m.ShipType, m.DimensionToBow+m.DimensionToStern, m.DimensionToPort+m.DimensionToStarboard, m.Draught, m.Destination)
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(m.MMSI, m.VesselName, m.CallSign, m.ShipType, m.DimensionToBow+m.DimensionToStern, m.DimensionToPort+m.DimensionToStarboard, m.Draught, m.Destination, m.IMONumber, feedID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) UpdateVesselFromPositionReportClassBStandard(m *nmeaais.PositionReportClassBStandard) error {
-	sql := fmt.Sprintf(`
+func (db *DB) UpdateVesselFromPositionReportClassBStandard(m *nmeaais.PositionReportClassBStandard, feedID int) error {
+	sql := `
 	insert into vessel
-	(mmsi, latitude, longitude, speed_over_ground, true_heading, course_over_ground, the_geog, updated_at)
+	(mmsi, latitude, longitude, speed_over_ground, true_heading, course_over_ground, class, feed_id, the_geog, updated_at)
 	values
-	($1, $2, $3, $4, $5, $6, ST_GeographyFromText('SRID=4326;POINT(%[1]f %[2]f)'), now())
+	($1, $2, $3, $4, $5, $6, 'B', $7, ST_SetSRID(ST_MakePoint($3, $2), 4326)::geography, now())
 	on conflict (mmsi)
 	do update set
 		latitude = EXCLUDED.latitude,
@@ -196,51 +397,71 @@ func (db *DB) UpdateVesselFromPositionReportClassBStandard(m *nmeaais.PositionRe
 		speed_over_ground = EXCLUDED.speed_over_ground,
 		true_heading = EXCLUDED.true_heading,
 		course_over_ground = EXCLUDED.course_over_ground,
+		class = EXCLUDED.class,
+		feed_id = EXCLUDED.feed_id,
 		the_geog = EXCLUDED.the_geog,
 		updated_at = EXCLUDED.updated_at
-	`, m.Longitude, m.Latitude)
+	`
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Exec(sql, m.MMSI, m.Latitude, m.Longitude, m.SpeedOverGround, m.TrueHeading, m.CourseOverGround)
+	_, err = stmt.Exec(m.MMSI, m.Latitude, m.Longitude, m.SpeedOverGround, m.TrueHeading, m.CourseOverGround, feedID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) UpdateVesselFromStaticDataReportA(m *nmeaais.StaticDataReportA) error {
+func (db *DB) UpdateVesselFromStaticDataReportA(m *nmeaais.StaticDataReportA, feedID int) error {
 	sql := `
 	insert into vessel
-	(mmsi, vessel_name, updated_at)
+	(mmsi, vessel_name, class, feed_id, updated_at)
 	values
-	($1, $2, now())
+	($1, $2, 'B', $3, now())
 	on conflict (mmsi)
 	do update set
 		vessel_name = EXCLUDED.vessel_name,
+		class = EXCLUDED.class,
+		feed_id = EXCLUDED.feed_id,
 		updated_at = EXCLUDED.updated_at
 	`
-	_, err := db.Exec(sql, m.MMSI, m.VesselName)
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(m.MMSI, m.VesselName, feedID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) UpdateVesselFromStaticDataReportB(m *nmeaais.StaticDataReportB) error {
+func (db *DB) UpdateVesselFromStaticDataReportB(m *nmeaais.StaticDataReportB, feedID int) error {
 	sql := `
 	insert into vessel
-	(mmsi, call_sign, ship_type, length, breadth, updated_at)
+	(mmsi, call_sign, ship_type, length, breadth, class, feed_id, updated_at)
 	values
-	($1, $2, $3, $4, $5, now())
+	($1, $2, $3, $4, $5, 'B', $6, now())
 	on conflict (mmsi)
 	do update set
 		call_sign = EXCLUDED.call_sign,
 		ship_type = EXCLUDED.ship_type,
 		length = EXCLUDED.length,
 		breadth = EXCLUDED.breadth,
+		class = EXCLUDED.class,
+		feed_id = EXCLUDED.feed_id,
 		draught = EXCLUDED.draught,
 		updated_at = EXCLUDED.updated_at
 	`
-	_, err := db.Exec(sql, m.MMSI, m.CallSign, m.ShipType, m.DimensionToBow+m.DimensionToStern, m.DimensionToPort+m.DimensionToStarboard)
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(m.MMSI, m.CallSign, m.ShipType, m.DimensionToBow+m.DimensionToStern, m.DimensionToPort+m.DimensionToStarboard, feedID)
 	if err != nil {
 		return err
 	}
@@ -248,14 +469,18 @@ func (db *DB) UpdateVesselFromStaticDataReportB(m *nmeaais.StaticDataReportB) er
 }
 
 func (db *DB) UpdatePositionFromPositionReportClassA(m *nmeaais.PositionReportClassA) error {
-	sql := fmt.Sprintf(`
+	sql := `
 	insert into position
 	(mmsi, latitude, longitude, the_geog, created_at)
 	values
-	($1, $2, $3, ST_GeographyFromText('SRID=4326;POINT(%[1]f %[2]f)'), now())
-	`, m.Longitude, m.Latitude)
+	($1, $2, $3, ST_SetSRID(ST_MakePoint($3, $2), 4326)::geography, now())
+	`
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Exec(sql, m.MMSI, m.Latitude, m.Longitude)
+	_, err = stmt.Exec(m.MMSI, m.Latitude, m.Longitude)
 	if err != nil {
 		return err
 	}
@@ -263,14 +488,18 @@ func (db *DB) UpdatePositionFromPositionReportClassA(m *nmeaais.PositionReportCl
 }
 
 func (db *DB) UpdatePositionFromPositionReportClassBStandard(m *nmeaais.PositionReportClassBStandard) error {
-	sql := fmt.Sprintf(`
+	sql := `
 	insert into position
 	(mmsi, latitude, longitude, the_geog, created_at)
 	values
-	($1, $2, $3, ST_GeographyFromText('SRID=4326;POINT(%[1]f %[2]f)'), now())
-	`, m.Longitude, m.Latitude)
+	($1, $2, $3, ST_SetSRID(ST_MakePoint($3, $2), 4326)::geography, now())
+	`
+	stmt, err := db.prepared(sql)
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Exec(sql, m.MMSI, m.Latitude, m.Longitude)
+	_, err = stmt.Exec(m.MMSI, m.Latitude, m.Longitude)
 	if err != nil {
 		return err
 	}
@@ -279,7 +508,7 @@ func (db *DB) UpdatePositionFromPositionReportClassBStandard(m *nmeaais.Position
 
 func (db *DB) GetMessageStatsJSON() ([]byte, error) {
 	var json []byte
-	err := db.QueryRow("select json_agg(message_stats) json from message_stats").Scan(&json)
+	err := db.QueryRow("select coalesce(json_agg(message_stats), '[]') json from message_stats").Scan(&json)
 	if err != nil {
 		return nil, err
 	}
@@ -288,7 +517,7 @@ func (db *DB) GetMessageStatsJSON() ([]byte, error) {
 
 func (db *DB) GetMessageStatsByVesselForTypeJSON(messageType int) ([]byte, error) {
 	var json []byte
-	err := db.QueryRow("select json_agg(message_stats_by_vessel) json from message_stats_by_vessel where type = $1", messageType).Scan(&json)
+	err := db.QueryRow("select coalesce(json_agg(message_stats_by_vessel), '[]') json from message_stats_by_vessel where type = $1", messageType).Scan(&json)
 	if err != nil {
 		return nil, err
 	}
@@ -297,7 +526,7 @@ func (db *DB) GetMessageStatsByVesselForTypeJSON(messageType int) ([]byte, error
 
 func (db *DB) GetMessageStatsByVesselJSON() ([]byte, error) {
 	var json []byte
-	err := db.QueryRow("select json_agg(message_stats_by_vessel) json from message_stats_by_vessel").Scan(&json)
+	err := db.QueryRow("select coalesce(json_agg(message_stats_by_vessel), '[]') json from message_stats_by_vessel").Scan(&json)
 	if err != nil {
 		return nil, err
 	}
@@ -306,7 +535,7 @@ func (db *DB) GetMessageStatsByVesselJSON() ([]byte, error) {
 
 func (db *DB) GetMessageStatsByVesselForVesselJSON(mmsi int) ([]byte, error) {
 	var json []byte
-	err := db.QueryRow("select json_agg(message_stats_by_vessel) json from message_stats_by_vessel where mmsi = $1", mmsi).Scan(&json)
+	err := db.QueryRow("select coalesce(json_agg(message_stats_by_vessel), '[]') json from message_stats_by_vessel where mmsi = $1", mmsi).Scan(&json)
 	if err != nil {
 		return nil, err
 	}
@@ -344,6 +573,8 @@ func (db *DB) GetFeeds() ([]*Feed, error) {
 			feed_id,
 			remote_address,
 			active,
+			latitude,
+			longitude,
 			created_at
 		from
 			feed
@@ -353,3 +584,89 @@ func (db *DB) GetFeeds() ([]*Feed, error) {
 	}
 	return feeds, nil
 }
+
+func (db *DB) GetFeed(feedID int) (*Feed, error) {
+	feed := &Feed{}
+	err := db.Get(feed, `
+		select
+			feed_id,
+			remote_address,
+			active,
+			latitude,
+			longitude,
+			created_at
+		from
+			feed
+		where
+			feed_id = $1
+	`, feedID)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+func (db *DB) AddFeed(remoteAddress string) (*Feed, error) {
+	feed := &Feed{}
+	err := db.Get(feed, `
+		insert into feed (remote_address)
+		values ($1)
+		returning
+			feed_id,
+			remote_address,
+			active,
+			latitude,
+			longitude,
+			created_at
+	`, remoteAddress)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+func (db *DB) SetFeedActive(feedID int, active bool) (*Feed, error) {
+	feed := &Feed{}
+	err := db.Get(feed, `
+		update feed
+		set active = $2
+		where
+			feed_id = $1
+		returning
+			feed_id,
+			remote_address,
+			active,
+			latitude,
+			longitude,
+			created_at
+	`, feedID, active)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// SetFeedLocation records where a feed's receiver is, which coverage
+// ranges are measured from.
+func (db *DB) SetFeedLocation(feedID int, latitude float64, longitude float64) (*Feed, error) {
+	feed := &Feed{}
+	err := db.Get(feed, `
+		update feed
+		set
+			latitude = $2,
+			longitude = $3
+		where
+			feed_id = $1
+		returning
+			feed_id,
+			remote_address,
+			active,
+			latitude,
+			longitude,
+			created_at
+	`, feedID, latitude, longitude)
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
@@ -0,0 +1,130 @@
+package ino
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ralreegorganon/nmeaais"
+)
+
+// benchMMSI is outside the range assigned to real stations so the rows the
+// benchmarks write can be found and removed afterwards.
+const benchMMSI = 999999999
+
+// benchFeedID is the feed seeded by the migrations, which every database has.
+const benchFeedID = 1
+
+// benchWarmup is how many writes each case makes before it's timed, so
+// connections, plans and prepared statements are in place for every case
+// rather than only the ones that happen to run second.
+const benchWarmup = 200
+
+// BenchmarkPositionWrite compares the old per-message SQL text against the
+// prepared statement for appending a position.
+func BenchmarkPositionWrite(b *testing.B) {
+	db := openBenchDB(b)
+	benchWrites(b,
+		func(m *nmeaais.PositionReportClassA) error { return adhocPosition(db, m) },
+		db.UpdatePositionFromPositionReportClassA,
+	)
+}
+
+// BenchmarkVesselWrite does the same for upserting the vessel.
+func BenchmarkVesselWrite(b *testing.B) {
+	db := openBenchDB(b)
+	benchWrites(b,
+		func(m *nmeaais.PositionReportClassA) error { return adhocVessel(db, m) },
+		func(m *nmeaais.PositionReportClassA) error {
+			return db.UpdateVesselFromPositionReportClassA(m, benchFeedID)
+		},
+	)
+}
+
+func openBenchDB(b *testing.B) *DB {
+	db := openTestDB(b)
+	b.Cleanup(func() {
+		for _, table := range []string{"position", "vessel"} {
+			if _, err := db.Exec("delete from "+table+" where mmsi = $1", benchMMSI); err != nil {
+				b.Errorf("couldn't clean up %v: %v", table, err)
+			}
+		}
+	})
+	return db
+}
+
+func benchWrites(b *testing.B, adhoc func(*nmeaais.PositionReportClassA) error, prepared func(*nmeaais.PositionReportClassA) error) {
+	cases := []struct {
+		name  string
+		write func(*nmeaais.PositionReportClassA) error
+	}{
+		{"adhoc", adhoc},
+		{"prepared", prepared},
+	}
+	for _, c := range cases {
+		write := c.write
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < benchWarmup; i++ {
+				if err := write(benchReport()); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := write(benchReport()); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func benchReport() *nmeaais.PositionReportClassA {
+	return &nmeaais.PositionReportClassA{
+		MMSI:             benchMMSI,
+		NavigationStatus: "Under way using engine",
+		SpeedOverGround:  rand.Float64() * 20,
+		Latitude:         rand.Float64()*180 - 90,
+		Longitude:        rand.Float64()*360 - 180,
+		CourseOverGround: rand.Float64() * 360,
+		TrueHeading:      rand.Int63n(360),
+	}
+}
+
+// adhocPosition and adhocVessel are the write path as it was before
+// statements were prepared, kept here as the baseline to measure against.
+func adhocPosition(db *DB, m *nmeaais.PositionReportClassA) error {
+	sql := fmt.Sprintf(`
+	insert into position
+	(mmsi, latitude, longitude, the_geog, created_at)
+	values
+	($1, $2, $3, ST_GeographyFromText('SRID=4326;POINT(%[1]f %[2]f)'), now())
+	`, m.Longitude, m.Latitude)
+	_, err := db.Exec(sql, m.MMSI, m.Latitude, m.Longitude)
+	return err
+}
+
+func adhocVessel(db *DB, m *nmeaais.PositionReportClassA) error {
+	sql := fmt.Sprintf(`
+	insert into vessel
+	(mmsi, latitude, longitude, speed_over_ground, true_heading, course_over_ground, navigation_status, the_geog, updated_at)
+	values
+	($1, $2, $3, $4, $5, $6, $7, ST_GeographyFromText('SRID=4326;POINT(%[1]f %[2]f)'), now())
+	on conflict (mmsi)
+	do update set
+		latitude = EXCLUDED.latitude,
+		longitude = EXCLUDED.longitude,
+		speed_over_ground = EXCLUDED.speed_over_ground,
+		true_heading = EXCLUDED.true_heading,
+		course_over_ground = EXCLUDED.course_over_ground,
+		navigation_status = EXCLUDED.navigation_status,
+		the_geog = EXCLUDED.the_geog,
+		updated_at = EXCLUDED.updated_at
+	`, m.Longitude, m.Latitude)
+	_, err := db.Exec(sql, m.MMSI, m.Latitude, m.Longitude, m.SpeedOverGround, m.TrueHeading, m.CourseOverGround, m.NavigationStatus)
+	return err
+}
@@ -0,0 +1,38 @@
+package ino
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+)
+
+// openTestDB connects to the PostGIS named by INO_TEST_CONNECTION_STRING and
+// brings it up to date, skipping the test when there isn't one. Tests write
+// real rows, so don't point it at anything you care about.
+func openTestDB(tb testing.TB) *DB {
+	tb.Helper()
+
+	connectionString := os.Getenv("INO_TEST_CONNECTION_STRING")
+	if connectionString == "" {
+		tb.Skip("INO_TEST_CONNECTION_STRING isn't set")
+	}
+
+	g, err := migrate.New("file://migrations", connectionString)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := g.Up(); err != nil && err != migrate.ErrNoChange {
+		tb.Fatal(err)
+	}
+	g.Close()
+
+	db := &DB{}
+	if err := db.Open(connectionString); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,95 @@
+package ino
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/ralreegorganon/nmeaais"
+)
+
+type payloadHash [sha256.Size]byte
+
+// hashPayload identifies a physical transmission by its armored payload,
+// which is identical no matter which receiver heard it.
+func hashPayload(packets []*nmeaais.Packet) payloadHash {
+	h := sha256.New()
+	for _, p := range packets {
+		h.Write([]byte(p.Payload))
+	}
+	var sum payloadHash
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// Deduplicator is shared by every Monstah so that a transmission heard by
+// more than one feed within the window is only stored as a single message.
+type Deduplicator struct {
+	window    time.Duration
+	mu        sync.Mutex
+	seen      map[payloadHash]*DedupClaim
+	lastSweep time.Time
+}
+
+// DedupClaim is the canonical record of a payload. The first feed to claim
+// a payload stores the message and resolves the claim with its id, later
+// feeds wait on it and record their reception against that id.
+type DedupClaim struct {
+	seenAt    time.Time
+	messageID int64
+	ready     chan struct{}
+}
+
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	d := &Deduplicator{
+		window:    window,
+		seen:      make(map[payloadHash]*DedupClaim),
+		lastSweep: time.Now(),
+	}
+	return d
+}
+
+// Claim returns the claim for a payload received at t, and whether the
+// caller is the first to see it within the window.
+func (d *Deduplicator) Claim(hash payloadHash, t time.Time) (*DedupClaim, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t.Sub(d.lastSweep) > d.window {
+		for k, c := range d.seen {
+			if t.Sub(c.seenAt) > d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.lastSweep = t
+	}
+
+	if c, ok := d.seen[hash]; ok && t.Sub(c.seenAt) <= d.window {
+		return c, false
+	}
+
+	c := &DedupClaim{
+		seenAt: t,
+		ready:  make(chan struct{}),
+	}
+	d.seen[hash] = c
+	return c, true
+}
+
+// Resolve records the id the claimed message was stored as. An id of zero
+// means storing it failed and waiters should store it themselves.
+func (c *DedupClaim) Resolve(messageID int64) {
+	c.messageID = messageID
+	close(c.ready)
+}
+
+// Wait blocks until the claim is resolved or the timeout passes, returning
+// the canonical message id if there is one.
+func (c *DedupClaim) Wait(timeout time.Duration) (int64, bool) {
+	select {
+	case <-c.ready:
+		return c.messageID, c.messageID != 0
+	case <-time.After(timeout):
+		return 0, false
+	}
+}
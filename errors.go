@@ -0,0 +1,180 @@
+package ino
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lib/pq"
+)
+
+// APIError is an error with the HTTP status it should be reported with.
+// Handlers return these for problems that are the client's doing; anything
+// else is classified by httpError.
+type APIError struct {
+	Status int
+	Err    error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func badRequestf(format string, a ...interface{}) error {
+	return &APIError{Status: http.StatusBadRequest, Err: fmt.Errorf(format, a...)}
+}
+
+func notFoundf(format string, a ...interface{}) error {
+	return &APIError{Status: http.StatusNotFound, Err: fmt.Errorf(format, a...)}
+}
+
+func unauthorizedf(format string, a ...interface{}) error {
+	return &APIError{Status: http.StatusUnauthorized, Err: fmt.Errorf(format, a...)}
+}
+
+func conflictf(format string, a ...interface{}) error {
+	return &APIError{Status: http.StatusConflict, Err: fmt.Errorf(format, a...)}
+}
+
+// Problem is an RFC 9457 problem details body.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// errorStatus decides what status an error from a handler deserves.
+func errorStatus(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound
+	}
+
+	if databaseUnavailable(err) {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// databaseUnavailable reports whether an error means we couldn't talk to
+// Postgres at all, as opposed to a query going wrong.
+func databaseUnavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions and 57P0x is the server shutting
+		// down or not accepting connections yet.
+		return pqErr.Code.Class() == "08" || strings.HasPrefix(string(pqErr.Code), "57P0")
+	}
+
+	var netErr *net.OpError
+	return errors.As(err, &netErr)
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+
+	status := errorStatus(err)
+	requestID := middleware.GetReqID(r.Context())
+
+	if status >= http.StatusInternalServerError {
+		slog.Error("http error", "requestId", requestID, "method", r.Method, "path", r.URL.Path, "status", status, slog.Any("error", err))
+	} else {
+		slog.Debug("http error", "requestId", requestID, "method", r.Method, "path", r.URL.Path, "status", status, slog.Any("error", err))
+	}
+
+	// Streaming handlers can fail after they've started their response, at
+	// which point all we can do is log.
+	if ww, ok := w.(middleware.WrapResponseWriter); ok && ww.Status() != 0 {
+		return
+	}
+
+	p := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  r.URL.Path,
+		RequestID: requestID,
+	}
+	switch {
+	case status == http.StatusNotFound && errors.Is(err, sql.ErrNoRows):
+		p.Detail = "resource not found"
+	case status == http.StatusServiceUnavailable:
+		p.Detail = "database unavailable"
+	case status < http.StatusInternalServerError:
+		p.Detail = strings.TrimPrefix(err.Error(), "ino: ")
+	}
+
+	b, _ := json.Marshal(p)
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ino"`)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// accessLog logs every request once it's been handled, along with the route
+// it matched and the request id it was given, and records it in the HTTP
+// metrics.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := middleware.GetReqID(r.Context())
+		w.Header().Set("X-Request-Id", requestID)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+
+		duration := time.Since(start)
+		observeRequest(r.Method, route, status, duration)
+
+		slog.Info("http request",
+			"requestId", requestID,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration", duration,
+			"remoteAddress", r.RemoteAddr,
+		)
+	})
+}
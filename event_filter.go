@@ -0,0 +1,72 @@
+package ino
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+)
+
+// eventFilter narrows down things that happen to vessels, like zone events
+// and voyages, by kind, vessel and time.
+type eventFilter struct {
+	Kinds []string
+	MMSI  null.Int
+	From  null.Time
+	To    null.Time
+	Limit int
+}
+
+// parseEventFilter reads an eventFilter from query parameters, allowing only
+// the given kinds:
+//
+//	kind=<kind>,<kind>
+//	mmsi=<mmsi>
+//	from=<RFC 3339>&to=<RFC 3339>
+//	limit=<count, default defaultLimit>
+func parseEventFilter(q url.Values, kinds []string, defaultLimit int, maxLimit int) (eventFilter, error) {
+	f := eventFilter{
+		Limit: defaultLimit,
+	}
+
+	for _, v := range q["kind"] {
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if !slices.Contains(kinds, p) {
+				return f, badRequestf("ino: invalid kind '%v', must be one of %v", p, strings.Join(kinds, ", "))
+			}
+			f.Kinds = append(f.Kinds, p)
+		}
+	}
+
+	if v := q.Get("mmsi"); v != "" {
+		mmsi, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, badRequestf("ino: invalid mmsi '%v'", v)
+		}
+		f.MMSI = null.IntFrom(mmsi)
+	}
+
+	for name, target := range map[string]*null.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, badRequestf("ino: invalid %v time '%v'", name, v)
+			}
+			*target = null.TimeFrom(t)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return f, badRequestf("ino: invalid limit '%v', must be between 1 and %v", v, maxLimit)
+		}
+		f.Limit = limit
+	}
+
+	return f, nil
+}
@@ -0,0 +1,474 @@
+package ino
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatGeoJSON = "geojson"
+	FormatKML     = "kml"
+	FormatGPX     = "gpx"
+	FormatCSV     = "csv"
+)
+
+var formatContentTypes = map[string]string{
+	FormatJSON:    "application/json",
+	FormatGeoJSON: "application/vnd.geo+json",
+	FormatKML:     "application/vnd.google-earth.kml+xml",
+	FormatGPX:     "application/gpx+xml",
+	FormatCSV:     "text/csv; charset=utf-8",
+}
+
+var acceptFormats = map[string]string{
+	"application/json":                     FormatJSON,
+	"application/geo+json":                 FormatGeoJSON,
+	"application/vnd.geo+json":             FormatGeoJSON,
+	"application/vnd.google-earth.kml+xml": FormatKML,
+	"application/gpx+xml":                  FormatGPX,
+	"text/csv":                             FormatCSV,
+}
+
+// responseFormat picks how to render a response. An explicit f query
+// parameter wins, then the most preferred type in the Accept header that we
+// know how to produce, then plain JSON.
+func responseFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("f"); f != "" {
+		f = strings.ToLower(f)
+		if _, ok := formatContentTypes[f]; !ok {
+			return "", badRequestf("ino: unsupported format '%v'", f)
+		}
+		return f, nil
+	}
+
+	type candidate struct {
+		format string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		format, ok := acceptFormats[strings.ToLower(strings.TrimSpace(mediaType))]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{format, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) > 0 {
+		return candidates[0].format, nil
+	}
+
+	return FormatJSON, nil
+}
+
+// writeExport sets the headers for a downloadable format and lets render
+// write the body.
+func writeExport(w http.ResponseWriter, format string, filename string, render func(io.Writer) error) error {
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v.%v\"", filename, format))
+	w.WriteHeader(http.StatusOK)
+	return render(w)
+}
+
+type kml struct {
+	XMLName  xml.Name    `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Styles     []kmlStyle     `xml:"Style"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlStyle struct {
+	ID        string        `xml:"id,attr,omitempty"`
+	IconStyle *kmlIconStyle `xml:"IconStyle,omitempty"`
+	LineStyle *kmlLineStyle `xml:"LineStyle,omitempty"`
+}
+
+type kmlIconStyle struct {
+	Color   string   `xml:"color,omitempty"`
+	Scale   float64  `xml:"scale,omitempty"`
+	Heading *float64 `xml:"heading,omitempty"`
+	Icon    kmlIcon  `xml:"Icon"`
+}
+
+type kmlIcon struct {
+	Href string `xml:"href"`
+}
+
+type kmlLineStyle struct {
+	Color string  `xml:"color"`
+	Width float64 `xml:"width"`
+}
+
+type kmlPlacemark struct {
+	Name         string           `xml:"name,omitempty"`
+	TimeStamp    *kmlTimeStamp    `xml:"TimeStamp,omitempty"`
+	TimeSpan     *kmlTimeSpan     `xml:"TimeSpan,omitempty"`
+	StyleURL     string           `xml:"styleUrl,omitempty"`
+	Style        *kmlStyle        `xml:"Style,omitempty"`
+	ExtendedData *kmlExtendedData `xml:"ExtendedData,omitempty"`
+	Point        *kmlPoint        `xml:"Point,omitempty"`
+	LineString   *kmlLineString   `xml:"LineString,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin,omitempty"`
+	End   string `xml:"end,omitempty"`
+}
+
+type kmlExtendedData struct {
+	Data []kmlData `xml:"Data"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+const kmlArrowIcon = "http://maps.google.com/mapfiles/kml/shapes/arrow.png"
+
+// kmlClassColors are KML's aabbggrr colors for class A and B vessels.
+var kmlClassColors = map[string]string{
+	"A": "ff0080ff",
+	"B": "ff00ffff",
+}
+
+func writeKML(w io.Writer, doc kmlDocument) error {
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(kml{Document: doc})
+}
+
+func renderVesselsKML(w io.Writer, vessels []*Vessel) error {
+	doc := kmlDocument{Name: "Vessels"}
+	for _, v := range vessels {
+		if !v.Latitude.Valid || !v.Longitude.Valid {
+			continue
+		}
+
+		icon := &kmlIconStyle{
+			Color: kmlClassColors[v.Class.String],
+			Icon:  kmlIcon{Href: kmlArrowIcon},
+		}
+		if heading, ok := vesselHeading(v); ok {
+			icon.Heading = &heading
+		}
+
+		name := v.VesselName.String
+		if name == "" {
+			name = strconv.FormatInt(v.MMSI, 10)
+		}
+
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:         name,
+			TimeStamp:    &kmlTimeStamp{When: v.UpdatedAt.UTC().Format(time.RFC3339)},
+			Style:        &kmlStyle{IconStyle: icon},
+			ExtendedData: &kmlExtendedData{Data: vesselData(v)},
+			Point:        &kmlPoint{Coordinates: kmlCoordinate(v.Longitude.Float64, v.Latitude.Float64)},
+		})
+	}
+	return writeKML(w, doc)
+}
+
+// renderTrackKML draws each segment of a track as a line, along with a point
+// for every position pointed at the next one. Every placemark carries a time
+// span so Google Earth's time slider can play the track back.
+func renderTrackKML(w io.Writer, mmsi int, segments [][]*Position) error {
+	doc := kmlDocument{
+		Name: fmt.Sprintf("Track for %v", mmsi),
+		Styles: []kmlStyle{
+			{ID: "track", LineStyle: &kmlLineStyle{Color: "ff0080ff", Width: 3}},
+		},
+	}
+
+	for i, segment := range segments {
+		coordinates := make([]string, len(segment))
+		for j, p := range segment {
+			coordinates[j] = kmlCoordinate(p.Longitude.Float64, p.Latitude.Float64)
+		}
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:       fmt.Sprintf("Segment %v", i+1),
+			TimeSpan:   &kmlTimeSpan{Begin: kmlTime(segment[0].CreatedAt), End: kmlTime(segment[len(segment)-1].CreatedAt)},
+			StyleURL:   "#track",
+			LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coordinates, " ")},
+		})
+
+		for j, p := range segment {
+			span := &kmlTimeSpan{Begin: kmlTime(p.CreatedAt)}
+			icon := &kmlIconStyle{Scale: 0.6, Icon: kmlIcon{Href: kmlArrowIcon}}
+			if j < len(segment)-1 {
+				next := segment[j+1]
+				span.End = kmlTime(next.CreatedAt)
+				heading := bearing(p.Latitude.Float64, p.Longitude.Float64, next.Latitude.Float64, next.Longitude.Float64)
+				icon.Heading = &heading
+			}
+			doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+				TimeSpan: span,
+				Style:    &kmlStyle{IconStyle: icon},
+				Point:    &kmlPoint{Coordinates: kmlCoordinate(p.Longitude.Float64, p.Latitude.Float64)},
+			})
+		}
+	}
+	return writeKML(w, doc)
+}
+
+func kmlCoordinate(lon, lat float64) string {
+	return strconv.FormatFloat(lon, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+}
+
+func kmlTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+type gpx struct {
+	XMLName   xml.Name      `xml:"http://www.topografix.com/GPX/1/1 gpx"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Tracks    []gpxTrack    `xml:"trk"`
+}
+
+type gpxWaypoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time,omitempty"`
+	Name string  `xml:"name,omitempty"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+type gpxTrack struct {
+	Name     string            `xml:"name"`
+	Segments []gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxWaypoint `xml:"trkpt"`
+}
+
+func writeGPX(w io.Writer, doc gpx) error {
+	doc.Version = "1.1"
+	doc.Creator = "ino"
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+func renderVesselsGPX(w io.Writer, vessels []*Vessel) error {
+	doc := gpx{}
+	for _, v := range vessels {
+		if !v.Latitude.Valid || !v.Longitude.Valid {
+			continue
+		}
+		name := v.VesselName.String
+		if name == "" {
+			name = strconv.FormatInt(v.MMSI, 10)
+		}
+		var desc []string
+		for _, d := range vesselData(v) {
+			if d.Value != "" {
+				desc = append(desc, d.Name+": "+d.Value)
+			}
+		}
+		doc.Waypoints = append(doc.Waypoints, gpxWaypoint{
+			Lat:  v.Latitude.Float64,
+			Lon:  v.Longitude.Float64,
+			Time: kmlTime(v.UpdatedAt),
+			Name: name,
+			Desc: strings.Join(desc, "\n"),
+		})
+	}
+	return writeGPX(w, doc)
+}
+
+func renderTrackGPX(w io.Writer, mmsi int, segments [][]*Position) error {
+	track := gpxTrack{Name: strconv.Itoa(mmsi)}
+	for _, segment := range segments {
+		s := gpxTrackSegment{}
+		for _, p := range segment {
+			s.Points = append(s.Points, gpxWaypoint{
+				Lat:  p.Latitude.Float64,
+				Lon:  p.Longitude.Float64,
+				Time: kmlTime(p.CreatedAt),
+			})
+		}
+		track.Segments = append(track.Segments, s)
+	}
+	return writeGPX(w, gpx{Tracks: []gpxTrack{track}})
+}
+
+var vesselCSVHeader = []string{
+	"mmsi", "vesselName", "callSign", "shipType", "length", "breadth", "draught",
+	"latitude", "longitude", "speedOverGround", "trueHeading", "courseOverGround",
+	"navigationStatus", "destination", "imoNumber", "class", "feedId", "updatedAt",
+}
+
+func renderVesselsCSV(w io.Writer, vessels []*Vessel) error {
+	cw := csv.NewWriter(w)
+	cw.Write(vesselCSVHeader)
+	for _, v := range vessels {
+		cw.Write(vesselCSVRow(v))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// renderNearVesselsCSV is the vessel CSV with how far away each vessel is
+// tacked on the end.
+func renderNearVesselsCSV(w io.Writer, vessels []*NearVessel) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append(vesselCSVHeader, "distance", "bearing"))
+	for _, v := range vessels {
+		cw.Write(append(vesselCSVRow(&v.Vessel), strconv.FormatFloat(v.Distance, 'f', -1, 64), text(v.Bearing)))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func vesselCSVRow(v *Vessel) []string {
+	return []string{
+		strconv.FormatInt(v.MMSI, 10),
+		text(v.VesselName), text(v.CallSign), text(v.ShipType),
+		text(v.Length), text(v.Breadth), text(v.Draught),
+		text(v.Latitude), text(v.Longitude),
+		text(v.SpeedOverGround), text(v.TrueHeading), text(v.CourseOverGround),
+		text(v.NavigationStatus), text(v.Destination), text(v.IMONumber), text(v.Class), text(v.FeedID),
+		v.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func renderPositionsCSV(w io.Writer, positions []*Position) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"positionId", "mmsi", "latitude", "longitude", "createdAt"})
+	for _, p := range positions {
+		cw.Write([]string{
+			strconv.FormatInt(p.PositionID, 10),
+			strconv.FormatInt(p.MMSI, 10),
+			text(p.Latitude), text(p.Longitude),
+			p.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// text renders a nullable value, with null as an empty string.
+func text(v encoding.TextMarshaler) string {
+	b, err := v.MarshalText()
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func vesselData(v *Vessel) []kmlData {
+	return []kmlData{
+		{"mmsi", strconv.FormatInt(v.MMSI, 10)},
+		{"callSign", text(v.CallSign)},
+		{"shipType", text(v.ShipType)},
+		{"class", text(v.Class)},
+		{"speedOverGround", text(v.SpeedOverGround)},
+		{"courseOverGround", text(v.CourseOverGround)},
+		{"trueHeading", text(v.TrueHeading)},
+		{"navigationStatus", text(v.NavigationStatus)},
+		{"destination", text(v.Destination)},
+		{"imoNumber", text(v.IMONumber)},
+	}
+}
+
+// vesselHeading prefers the reported true heading, falling back to course
+// over ground when the heading isn't available.
+func vesselHeading(v *Vessel) (float64, bool) {
+	if v.TrueHeading.Valid && v.TrueHeading.Float64 < 360 {
+		return v.TrueHeading.Float64, true
+	}
+	if v.CourseOverGround.Valid && v.CourseOverGround.Float64 < 360 {
+		return v.CourseOverGround.Float64, true
+	}
+	return 0, false
+}
+
+// trackSegments puts positions, which come back from the database newest
+// first, into time order and splits them wherever the filter's gap thresholds
+// say the GeoJSON track would start a new segment.
+func trackSegments(positions []*Position, filter *TrackFilter) [][]*Position {
+	var segments [][]*Position
+	var current []*Position
+	for i := len(positions) - 1; i >= 0; i-- {
+		p := positions[i]
+		if !p.Latitude.Valid || !p.Longitude.Valid {
+			continue
+		}
+		if n := len(current); n > 0 {
+			prev := current[n-1]
+			if (filter.Gap > 0 && p.CreatedAt.Sub(prev.CreatedAt) > filter.Gap) ||
+				(filter.GapDistance > 0 && distance(prev.Latitude.Float64, prev.Longitude.Float64, p.Latitude.Float64, p.Longitude.Float64) > filter.GapDistance) {
+				segments = append(segments, current)
+				current = nil
+			}
+		}
+		current = append(current, p)
+	}
+	if len(current) > 0 {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+const earthRadius = 6371008.8
+
+// distance is the haversine distance in meters between two points.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi := phi2 - phi1
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// bearing is the initial compass bearing in degrees from one point to another.
+func bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
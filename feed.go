@@ -1,12 +1,142 @@
 package ino
 
 import (
+	"encoding/json"
+	"net"
+	"net/http"
 	"time"
+
+	"github.com/guregu/null/v5"
 )
 
+// maxRequestBody bounds the JSON bodies the API accepts.
+const maxRequestBody = 1 << 20
+
 type Feed struct {
-	FeedID        int64     `json:"feedId" db:"feed_id"`
-	RemoteAddress string    `json:"remoteAddress" db:"remote_address"`
-	Active        bool      `json:"active" db:"active"`
-	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+	FeedID        int64      `json:"feedId" db:"feed_id"`
+	RemoteAddress string     `json:"remoteAddress" db:"remote_address"`
+	Active        bool       `json:"active" db:"active"`
+	Latitude      null.Float `json:"latitude" db:"latitude"`
+	Longitude     null.Float `json:"longitude" db:"longitude"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// FeedCreate is the body of a request to add a feed.
+type FeedCreate struct {
+	RemoteAddress string `json:"remoteAddress"`
+}
+
+// FeedUpdate is the body of a request to change a feed.
+type FeedUpdate struct {
+	Active    *bool    `json:"active"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+// decodeBody reads a JSON request body into v.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequestf("ino: invalid request body: %v", err)
+	}
+	return nil
+}
+
+func (s *HTTPServer) GetFeeds(w http.ResponseWriter, r *http.Request) error {
+	feeds, err := s.DB.GetFeeds()
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, feeds)
+	return nil
+}
+
+func (s *HTTPServer) GetFeed(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	feed, err := s.DB.GetFeed(feedID)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, feed)
+	return nil
+}
+
+func (s *HTTPServer) CreateFeed(w http.ResponseWriter, r *http.Request) error {
+	var body FeedCreate
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	if _, _, err := net.SplitHostPort(body.RemoteAddress); err != nil {
+		return badRequestf("ino: invalid remoteAddress '%v', must be host:port", body.RemoteAddress)
+	}
+
+	feed, err := s.Feeds.AddFeed(body.RemoteAddress)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, feed)
+	return nil
+}
+
+func (s *HTTPServer) UpdateFeed(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	var body FeedUpdate
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	located := body.Latitude != nil || body.Longitude != nil
+	if body.Active == nil && !located {
+		return badRequestf("ino: active or a location is required")
+	}
+	if located {
+		if body.Latitude == nil || body.Longitude == nil {
+			return badRequestf("ino: latitude and longitude go together")
+		}
+		if *body.Latitude < -90 || *body.Latitude > 90 || *body.Longitude < -180 || *body.Longitude > 180 {
+			return badRequestf("ino: invalid location %v, %v", *body.Latitude, *body.Longitude)
+		}
+	}
+
+	var feed *Feed
+	if located {
+		if feed, err = s.DB.SetFeedLocation(feedID, *body.Latitude, *body.Longitude); err != nil {
+			return err
+		}
+	}
+	if body.Active != nil {
+		if feed, err = s.Feeds.SetFeedActive(feedID, *body.Active); err != nil {
+			return err
+		}
+	}
+
+	writeJSON(w, http.StatusOK, feed)
+	return nil
+}
+
+// DeleteFeed stops decoding a feed. Its messages and errors are kept, and
+// it can be started again by setting it active.
+func (s *HTTPServer) DeleteFeed(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Feeds.SetFeedActive(feedID, false); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
 }
@@ -0,0 +1,327 @@
+package ino
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/jmoiron/sqlx/types"
+)
+
+const (
+	defaultFeedStatsWindow = 24 * time.Hour
+	// maxFeedRateWindow keeps the per minute series to a week of points per
+	// feed.
+	maxFeedRateWindow  = 7 * 24 * time.Hour
+	maxFeedStatsWindow = 90 * 24 * time.Hour
+)
+
+// FeedStats is what a feed heard over a window. Duplicates of messages
+// another feed heard first count, since the feed still received them.
+type FeedStats struct {
+	FeedID        int64  `json:"feedId" db:"feed_id"`
+	RemoteAddress string `json:"remoteAddress" db:"remote_address"`
+	Messages      int64  `json:"messages" db:"messages"`
+	Vessels       int64  `json:"vessels" db:"vessels"`
+	// ExclusiveVessels are vessels no other feed heard over the window.
+	ExclusiveVessels int64 `json:"exclusiveVessels" db:"exclusive_vessels"`
+	// Types maps message types to how many of each the feed heard.
+	Types types.JSONText `json:"types" db:"types"`
+}
+
+// FeedRate is a count for one feed over one bucket of a time series.
+type FeedRate struct {
+	FeedID int64     `json:"feedId" db:"feed_id"`
+	Time   time.Time `json:"time" db:"bucket"`
+	Count  int64     `json:"count" db:"count"`
+}
+
+// ExclusiveVessel is a vessel only one feed heard.
+type ExclusiveVessel struct {
+	MMSI       int64       `json:"mmsi" db:"mmsi"`
+	VesselName null.String `json:"vesselName" db:"vessel_name"`
+	Messages   int64       `json:"messages" db:"messages"`
+	Last       time.Time   `json:"last" db:"last"`
+}
+
+func (db *DB) GetFeedStats(window time.Duration) ([]*FeedStats, error) {
+	stats := []*FeedStats{}
+	err := db.Select(&stats, `
+		with
+		receptions as
+		(
+			select
+				r.feed_id,
+				m.mmsi,
+				m.type
+			from
+				message_reception r
+				join message m on m.message_id = r.message_id
+			where
+				r.created_at > now() - make_interval(secs => $1)
+		),
+		counts as
+		(
+			select
+				feed_id,
+				count(1) messages,
+				count(distinct mmsi) vessels
+			from
+				receptions
+			group by
+				feed_id
+		),
+		exclusive as
+		(
+			select
+				min(feed_id) feed_id,
+				mmsi
+			from
+				receptions
+			group by
+				mmsi
+			having
+				count(distinct feed_id) = 1
+		),
+		types as
+		(
+			select
+				feed_id,
+				json_object_agg(type, count order by type) types
+			from
+			(
+				select
+					feed_id,
+					type,
+					count(1) count
+				from
+					receptions
+				group by
+					feed_id,
+					type
+			) t
+			group by
+				feed_id
+		)
+		select
+			f.feed_id,
+			f.remote_address,
+			coalesce(c.messages, 0) messages,
+			coalesce(c.vessels, 0) vessels,
+			(select count(1) from exclusive e where e.feed_id = f.feed_id) exclusive_vessels,
+			coalesce(t.types, '{}') types
+		from
+			feed f
+			left join counts c on c.feed_id = f.feed_id
+			left join types t on t.feed_id = f.feed_id
+		order by
+			f.feed_id
+	`, window.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetFeedMessageRate counts the messages each feed heard per minute. Minutes
+// a feed heard nothing are left out.
+func (db *DB) GetFeedMessageRate(window time.Duration, feedID null.Int) ([]*FeedRate, error) {
+	rates := []*FeedRate{}
+	err := db.Select(&rates, `
+		select
+			feed_id,
+			date_trunc('minute', created_at) bucket,
+			count(1) count
+		from
+			message_reception
+		where
+			created_at > now() - make_interval(secs => $1)
+			and ($2::integer is null or feed_id = $2)
+		group by
+			feed_id,
+			bucket
+		order by
+			bucket,
+			feed_id
+	`, window.Seconds(), feedID)
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// GetFeedVesselRate counts the distinct vessels each feed heard per hour.
+func (db *DB) GetFeedVesselRate(window time.Duration, feedID null.Int) ([]*FeedRate, error) {
+	rates := []*FeedRate{}
+	err := db.Select(&rates, `
+		select
+			r.feed_id,
+			date_trunc('hour', r.created_at) bucket,
+			count(distinct m.mmsi) count
+		from
+			message_reception r
+			join message m on m.message_id = r.message_id
+		where
+			r.created_at > now() - make_interval(secs => $1)
+			and ($2::integer is null or r.feed_id = $2)
+		group by
+			r.feed_id,
+			bucket
+		order by
+			bucket,
+			r.feed_id
+	`, window.Seconds(), feedID)
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// GetExclusiveVessels lists the vessels only the given feed heard over the
+// window, the most heard first.
+func (db *DB) GetExclusiveVessels(feedID int, window time.Duration) ([]*ExclusiveVessel, error) {
+	vessels := []*ExclusiveVessel{}
+	err := db.Select(&vessels, `
+		with heard as
+		(
+			select
+				m.mmsi,
+				min(r.feed_id) feed_id,
+				count(1) messages,
+				max(r.created_at) last
+			from
+				message_reception r
+				join message m on m.message_id = r.message_id
+			where
+				r.created_at > now() - make_interval(secs => $1)
+			group by
+				m.mmsi
+			having
+				count(distinct r.feed_id) = 1
+		)
+		select
+			h.mmsi,
+			v.vessel_name,
+			h.messages,
+			h.last
+		from
+			heard h
+			left join vessel v on v.mmsi = h.mmsi
+		where
+			h.feed_id = $2
+		order by
+			h.messages desc,
+			h.mmsi
+	`, window.Seconds(), feedID)
+	if err != nil {
+		return nil, err
+	}
+	return vessels, nil
+}
+
+// parseWindow reads the window parameter, a Go duration.
+func parseWindow(q url.Values, fallback time.Duration, max time.Duration) (time.Duration, error) {
+	v := q.Get("window")
+	if v == "" {
+		return fallback, nil
+	}
+	window, err := time.ParseDuration(v)
+	if err != nil || window <= 0 || window > max {
+		return 0, badRequestf("ino: invalid window '%v', must be a duration up to %v", v, max)
+	}
+	return window, nil
+}
+
+// parseFeedParam reads the optional feed parameter.
+func parseFeedParam(q url.Values) (null.Int, error) {
+	v := q.Get("feed")
+	if v == "" {
+		return null.Int{}, nil
+	}
+	feedID, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return null.Int{}, badRequestf("ino: invalid feed '%v'", v)
+	}
+	return null.IntFrom(feedID), nil
+}
+
+func (s *HTTPServer) GetFeedStats(w http.ResponseWriter, r *http.Request) error {
+	window, err := parseWindow(r.URL.Query(), defaultFeedStatsWindow, maxFeedStatsWindow)
+	if err != nil {
+		return err
+	}
+
+	stats, err := s.DB.GetFeedStats(window)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+	return nil
+}
+
+func (s *HTTPServer) GetFeedMessageRate(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	window, err := parseWindow(query, time.Hour, maxFeedRateWindow)
+	if err != nil {
+		return err
+	}
+	feedID, err := parseFeedParam(query)
+	if err != nil {
+		return err
+	}
+
+	rates, err := s.DB.GetFeedMessageRate(window, feedID)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, rates)
+	return nil
+}
+
+func (s *HTTPServer) GetFeedVesselRate(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	window, err := parseWindow(query, defaultFeedStatsWindow, maxFeedStatsWindow)
+	if err != nil {
+		return err
+	}
+	feedID, err := parseFeedParam(query)
+	if err != nil {
+		return err
+	}
+
+	rates, err := s.DB.GetFeedVesselRate(window, feedID)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, rates)
+	return nil
+}
+
+func (s *HTTPServer) GetExclusiveVessels(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	window, err := parseWindow(r.URL.Query(), defaultFeedStatsWindow, maxFeedStatsWindow)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetFeed(feedID); err != nil {
+		return err
+	}
+
+	vessels, err := s.DB.GetExclusiveVessels(feedID, window)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, vessels)
+	return nil
+}
@@ -0,0 +1,161 @@
+package ino
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/guregu/null/v5"
+)
+
+const (
+	defaultFeedStaleness = 5 * time.Minute
+	healthCheckTimeout   = 2 * time.Second
+)
+
+type HealthOptions struct {
+	// MinFeeds is how many feeds have to be delivering packets for ino to be
+	// ready.
+	MinFeeds int
+	// Staleness is how long a feed can go without sending a line before it
+	// doesn't count as delivering.
+	Staleness time.Duration
+	// SchemaVersion is the migration the database was brought up to at
+	// startup, which it's expected to stay at.
+	SchemaVersion uint
+}
+
+// FeedStatus is how a running feed's connection is doing.
+type FeedStatus struct {
+	FeedID        int64     `json:"feedId"`
+	RemoteAddress string    `json:"remoteAddress"`
+	Connected     bool      `json:"connected"`
+	Reconnects    int64     `json:"reconnects"`
+	LastPacketAt  null.Time `json:"lastPacketAt"`
+	// Delivering is whether the feed has sent a line within the staleness
+	// threshold.
+	Delivering bool `json:"delivering"`
+}
+
+// FeedStatus reports on every feed that's being decoded.
+func (mm *MonstahManager) FeedStatus(staleness time.Duration) []FeedStatus {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]FeedStatus, len(mm.monstahs))
+	for i, m := range mm.monstahs {
+		statuses[i] = FeedStatus{
+			FeedID:        mm.feeds[i].FeedID,
+			RemoteAddress: mm.feeds[i].RemoteAddress,
+			Connected:     m.connected.Load(),
+			Reconnects:    m.reconnects.Load(),
+		}
+		if last := m.lastPacket.Load(); last != 0 {
+			t := time.Unix(0, last)
+			statuses[i].LastPacketAt = null.TimeFrom(t)
+			statuses[i].Delivering = now.Sub(t) < staleness
+		}
+	}
+	return statuses
+}
+
+// SchemaVersion is the migration the database is at, and whether the last
+// migration failed partway.
+func (db *DB) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRowContext(ctx, "select version, dirty from schema_migrations limit 1").Scan(&version, &dirty)
+	if err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
+
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+func (s *HTTPServer) staleness() time.Duration {
+	if s.Health.Staleness > 0 {
+		return s.Health.Staleness
+	}
+	return defaultFeedStaleness
+}
+
+func (s *HTTPServer) checkDatabase(ctx context.Context) HealthCheck {
+	if err := s.DB.PingContext(ctx); err != nil {
+		return HealthCheck{Name: "database", Detail: err.Error()}
+	}
+	return HealthCheck{Name: "database", OK: true}
+}
+
+func (s *HTTPServer) checkMigrations(ctx context.Context) HealthCheck {
+	version, dirty, err := s.DB.SchemaVersion(ctx)
+	switch {
+	case err != nil:
+		return HealthCheck{Name: "migrations", Detail: err.Error()}
+	case dirty:
+		return HealthCheck{Name: "migrations", Detail: fmt.Sprintf("migration %v failed partway", version)}
+	case version != s.Health.SchemaVersion:
+		return HealthCheck{Name: "migrations", Detail: fmt.Sprintf("database is at %v, expected %v", version, s.Health.SchemaVersion)}
+	}
+	return HealthCheck{Name: "migrations", OK: true, Detail: fmt.Sprintf("at %v", version)}
+}
+
+func (s *HTTPServer) checkFeeds() HealthCheck {
+	delivering := 0
+	for _, status := range s.Feeds.FeedStatus(s.staleness()) {
+		if status.Delivering {
+			delivering++
+		}
+	}
+	detail := fmt.Sprintf("%v delivering within %v, %v needed", delivering, s.staleness(), s.Health.MinFeeds)
+	return HealthCheck{Name: "feeds", OK: delivering >= s.Health.MinFeeds, Detail: detail}
+}
+
+// writeHealth responds 200 if every check passed and 503 otherwise.
+func writeHealth(w http.ResponseWriter, checks ...HealthCheck) {
+	health := Health{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			health.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, health)
+}
+
+// Healthz is liveness: the process is up and can reach the database.
+func (s *HTTPServer) Healthz(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	writeHealth(w, s.checkDatabase(ctx))
+	return nil
+}
+
+// Readyz is readiness: on top of liveness, the schema is where it should be
+// and enough feeds are actually delivering data.
+func (s *HTTPServer) Readyz(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	writeHealth(w, s.checkDatabase(ctx), s.checkMigrations(ctx), s.checkFeeds())
+	return nil
+}
+
+func (s *HTTPServer) GetFeedStatus(w http.ResponseWriter, r *http.Request) error {
+	writeJSON(w, http.StatusOK, s.Feeds.FeedStatus(s.staleness()))
+	return nil
+}
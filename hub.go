@@ -0,0 +1,262 @@
+package ino
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ralreegorganon/nmeaais"
+)
+
+// subscriptionBuffer is how many updates a subscriber can fall behind by
+// before it's considered too slow and dropped.
+const subscriptionBuffer = 256
+
+// StreamFilter limits a subscription to vessels inside a bounding box and/or
+// to a set of MMSIs. The zero value passes everything.
+type StreamFilter struct {
+	// BBox is min longitude, min latitude, max longitude, max latitude.
+	BBox  []float64
+	MMSIs map[int64]bool
+}
+
+// ParseStreamFilter reads a StreamFilter from query parameters:
+//
+//	bbox=minLon,minLat,maxLon,maxLat
+//	mmsi=<mmsi>,<mmsi>&mmsi=<mmsi>
+func ParseStreamFilter(q url.Values) (StreamFilter, error) {
+	f := StreamFilter{}
+
+	if v := q.Get("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return f, badRequestf("ino: bbox needs 4 coordinates, got %v", len(parts))
+		}
+		for _, p := range parts {
+			c, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return f, badRequestf("ino: invalid bbox coordinate '%v'", p)
+			}
+			f.BBox = append(f.BBox, c)
+		}
+	}
+
+	for _, v := range q["mmsi"] {
+		for _, p := range strings.Split(v, ",") {
+			mmsi, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+			if err != nil {
+				return f, badRequestf("ino: invalid mmsi '%v'", p)
+			}
+			if f.MMSIs == nil {
+				f.MMSIs = make(map[int64]bool)
+			}
+			f.MMSIs[mmsi] = true
+		}
+	}
+
+	return f, nil
+}
+
+func (f StreamFilter) matches(mmsi int64, position *[2]float64) bool {
+	if f.MMSIs != nil && !f.MMSIs[mmsi] {
+		return false
+	}
+	if len(f.BBox) == 4 {
+		if position == nil {
+			return false
+		}
+		lon, lat := position[0], position[1]
+		if lon < f.BBox[0] || lat < f.BBox[1] || lon > f.BBox[2] || lat > f.BBox[3] {
+			return false
+		}
+	}
+	return true
+}
+
+// Subscription receives vessel updates as GeoJSON features. Updates is
+// closed when the subscriber is dropped for falling behind or unsubscribes.
+type Subscription struct {
+	Updates chan []byte
+	filter  StreamFilter
+}
+
+// Hub fans vessel updates out from the decoders to live API subscribers.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+	// positions remembers where each vessel was last seen so static data
+	// updates can be matched against bounding boxes too.
+	positions map[int64][2]float64
+}
+
+func NewHub() *Hub {
+	h := &Hub{
+		subs:      make(map[*Subscription]struct{}),
+		positions: make(map[int64][2]float64),
+	}
+	return h
+}
+
+func (h *Hub) Subscribe(filter StreamFilter) *Subscription {
+	s := &Subscription{
+		Updates: make(chan []byte, subscriptionBuffer),
+		filter:  filter,
+	}
+
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.Updates)
+	}
+}
+
+// Subscribers is how many clients are subscribed.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Publish turns a decoded message into a vessel update and hands it to every
+// matching subscriber without blocking. Subscribers whose buffers are full
+// are dropped rather than holding up the decoder.
+func (h *Hub) Publish(o nmeaais.DecoderOutput) {
+	mmsi, position, properties := vesselUpdate(o)
+	if properties == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if position != nil {
+		h.positions[mmsi] = *position
+	} else if p, ok := h.positions[mmsi]; ok {
+		position = &p
+	}
+
+	if len(h.subs) == 0 {
+		return
+	}
+
+	feature := map[string]interface{}{
+		"type":       "Feature",
+		"geometry":   nil,
+		"properties": properties,
+	}
+	if position != nil {
+		feature["geometry"] = map[string]interface{}{
+			"type":        "Point",
+			"coordinates": position[:],
+		}
+	}
+	b, err := json.Marshal(feature)
+	if err != nil {
+		slog.Error("Couldn't marshal vessel update", "mmsi", mmsi, slog.Any("error", err))
+		return
+	}
+
+	for s := range h.subs {
+		if !s.filter.matches(mmsi, position) {
+			continue
+		}
+		select {
+		case s.Updates <- b:
+		default:
+			slog.Info("Dropping slow stream subscriber")
+			delete(h.subs, s)
+			close(s.Updates)
+		}
+	}
+}
+
+// vesselUpdate picks the fields of a decoded message that the vessel table
+// tracks, using the same property names as the vessel GeoJSON.
+func vesselUpdate(o nmeaais.DecoderOutput) (int64, *[2]float64, map[string]interface{}) {
+	now := time.Now()
+	switch dm := o.DecodedMessage.(type) {
+	case *nmeaais.PositionReportClassA:
+		p := map[string]interface{}{
+			"mmsi":             dm.MMSI,
+			"update":           "position",
+			"class":            "A",
+			"speedOverGround":  dm.SpeedOverGround,
+			"trueHeading":      dm.TrueHeading,
+			"courseOverGround": dm.CourseOverGround,
+			"navigationStatus": dm.NavigationStatus,
+			"updatedAt":        now,
+		}
+		return dm.MMSI, validPosition(dm.Longitude, dm.Latitude), p
+	case *nmeaais.PositionReportClassBStandard:
+		p := map[string]interface{}{
+			"mmsi":             dm.MMSI,
+			"update":           "position",
+			"class":            "B",
+			"speedOverGround":  dm.SpeedOverGround,
+			"trueHeading":      dm.TrueHeading,
+			"courseOverGround": dm.CourseOverGround,
+			"updatedAt":        now,
+		}
+		return dm.MMSI, validPosition(dm.Longitude, dm.Latitude), p
+	case *nmeaais.StaticAndVoyageRelatedData:
+		p := map[string]interface{}{
+			"mmsi":        dm.MMSI,
+			"update":      "static",
+			"class":       "A",
+			"vesselName":  dm.VesselName,
+			"callSign":    dm.CallSign,
+			"shipType":    dm.ShipType,
+			"length":      dm.DimensionToBow + dm.DimensionToStern,
+			"breadth":     dm.DimensionToPort + dm.DimensionToStarboard,
+			"draught":     dm.Draught,
+			"destination": dm.Destination,
+			"imoNumber":   dm.IMONumber,
+			"updatedAt":   now,
+		}
+		return dm.MMSI, nil, p
+	case *nmeaais.StaticDataReportA:
+		p := map[string]interface{}{
+			"mmsi":       dm.MMSI,
+			"update":     "static",
+			"class":      "B",
+			"vesselName": dm.VesselName,
+			"updatedAt":  now,
+		}
+		return dm.MMSI, nil, p
+	case *nmeaais.StaticDataReportB:
+		p := map[string]interface{}{
+			"mmsi":      dm.MMSI,
+			"update":    "static",
+			"class":     "B",
+			"callSign":  dm.CallSign,
+			"shipType":  dm.ShipType,
+			"length":    dm.DimensionToBow + dm.DimensionToStern,
+			"breadth":   dm.DimensionToPort + dm.DimensionToStarboard,
+			"updatedAt": now,
+		}
+		return dm.MMSI, nil, p
+	default:
+		return 0, nil, nil
+	}
+}
+
+func validPosition(lon, lat float64) *[2]float64 {
+	if lat == 91 || lon == 181 {
+		return nil
+	}
+	return &[2]float64{lon, lat}
+}
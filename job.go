@@ -0,0 +1,65 @@
+package ino
+
+import (
+	"log/slog"
+	"time"
+)
+
+// settleLag keeps the newest rows back from jobs that work forward through
+// ids, like rollups and voyage segmenting, until inserts that started before
+// them have had time to commit. Ids are handed out as inserts start, so a
+// lower one can still turn up after a higher one has been seen.
+const settleLag = 10 * time.Second
+
+// periodicJob runs a job straight away and then every interval, until it's
+// stopped.
+type periodicJob struct {
+	shutdown chan struct{}
+	stopped  chan struct{}
+}
+
+func newPeriodicJob() *periodicJob {
+	return &periodicJob{
+		shutdown: make(chan struct{}),
+	}
+}
+
+// start runs the job in a goroutine of its own, logging what it returns
+// with msg when it fails.
+func (j *periodicJob) start(interval time.Duration, msg string, run func() error) {
+	j.stopped = make(chan struct{})
+	go func() {
+		defer close(j.stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			if err := run(); err != nil {
+				slog.Error(msg, slog.Any("error", err))
+			}
+			select {
+			case <-t.C:
+			case <-j.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops the job, waiting for a run that's under way to finish. Runs
+// that go on for a while should give up early once stopping says so.
+func (j *periodicJob) stop() {
+	close(j.shutdown)
+	if j.stopped != nil {
+		<-j.stopped
+	}
+}
+
+// stopping reports whether stop has been called.
+func (j *periodicJob) stopping() bool {
+	select {
+	case <-j.shutdown:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,307 @@
+package ino
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+const (
+	FormatNMEA = "nmea"
+
+	defaultMessageLimit = 100
+	maxMessageLimit     = 1000
+)
+
+type Message struct {
+	MessageID int64          `json:"messageId" db:"message_id"`
+	MMSI      int64          `json:"mmsi" db:"mmsi"`
+	Type      int64          `json:"type" db:"type"`
+	Message   types.JSONText `json:"message" db:"message"`
+	Raw       string         `json:"raw" db:"raw"`
+	FeedID    null.Int       `json:"feedId" db:"feed_id"`
+	CreatedAt time.Time      `json:"createdAt" db:"created_at"`
+}
+
+// MessageFilter selects stored messages for a vessel or as received by a
+// feed. Exactly one of MMSI and FeedID is expected to be set. For a feed,
+// times are when the feed heard the message, which for a duplicate can be
+// later than when it was first stored.
+type MessageFilter struct {
+	MMSI   null.Int
+	FeedID null.Int
+	Types  []int64
+	From   null.Time
+	To     null.Time
+	// Limit and Cursor page through messages newest first. A zero Limit
+	// returns everything.
+	Limit  int
+	Cursor *MessageCursor
+	// Oldest lists messages oldest first instead, the order they're
+	// replayed in.
+	Oldest bool
+}
+
+// MessageCursor is the message a page of results ended on.
+type MessageCursor struct {
+	CreatedAt time.Time
+	MessageID int64
+}
+
+func (c *MessageCursor) String() string {
+	return encodeCursor(c.CreatedAt, c.MessageID)
+}
+
+// ParseMessageFilter reads a MessageFilter from query parameters:
+//
+//	type=<message type>,<message type>&type=<message type>
+//	from=<RFC 3339>&to=<RFC 3339>
+//	limit=<count, default 100>&cursor=<cursor from the previous page's Link header>
+//
+// The limit only defaults when a default is given, so that full logs can be
+// downloaded.
+func ParseMessageFilter(q url.Values, defaultLimit int) (*MessageFilter, error) {
+	f := &MessageFilter{
+		Limit: defaultLimit,
+	}
+
+	for _, v := range q["type"] {
+		for _, p := range strings.Split(v, ",") {
+			t, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+			if err != nil {
+				return nil, badRequestf("ino: invalid message type '%v'", p)
+			}
+			f.Types = append(f.Types, t)
+		}
+	}
+
+	for name, target := range map[string]*null.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, badRequestf("ino: invalid %v time '%v'", name, v)
+			}
+			*target = null.TimeFrom(t)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxMessageLimit {
+			return nil, badRequestf("ino: invalid limit '%v', must be between 1 and %v", v, maxMessageLimit)
+		}
+		f.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		t, id, err := decodeCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		f.Cursor = &MessageCursor{CreatedAt: t, MessageID: id}
+	}
+
+	return f, nil
+}
+
+// query renders the filter as a select over messages, along with its
+// parameters numbered from $1.
+func (f *MessageFilter) query() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	from := "message m"
+	feedID := "m.feed_id"
+	createdAt := "m.created_at"
+	if f.FeedID.Valid {
+		from = "message m join message_reception r on r.message_id = m.message_id"
+		feedID = "r.feed_id"
+		createdAt = "r.created_at"
+		clauses = append(clauses, fmt.Sprintf("r.feed_id = %v", arg(f.FeedID.Int64)))
+	}
+	if f.MMSI.Valid {
+		clauses = append(clauses, fmt.Sprintf("m.mmsi = %v", arg(f.MMSI.Int64)))
+	}
+	if len(f.Types) > 0 {
+		clauses = append(clauses, fmt.Sprintf("m.type = any(%v)", arg(pq.Array(f.Types))))
+	}
+	if f.From.Valid {
+		clauses = append(clauses, fmt.Sprintf("%v >= %v", createdAt, arg(f.From.Time)))
+	}
+	if f.To.Valid {
+		clauses = append(clauses, fmt.Sprintf("%v < %v", createdAt, arg(f.To.Time)))
+	}
+	order, after := "desc", "<"
+	if f.Oldest {
+		order, after = "asc", ">"
+	}
+	if f.Cursor != nil {
+		clauses = append(clauses, fmt.Sprintf("(%v, m.message_id) %v (%v, %v)", createdAt, after, arg(f.Cursor.CreatedAt), arg(f.Cursor.MessageID)))
+	}
+
+	query := fmt.Sprintf(`
+		select
+			m.message_id,
+			m.mmsi,
+			m.type,
+			m.message,
+			m.raw,
+			%[1]v feed_id,
+			%[2]v created_at
+		from
+			%[3]v
+	`, feedID, createdAt, from)
+	if len(clauses) > 0 {
+		query += " where " + strings.Join(clauses, " and ")
+	}
+	query += fmt.Sprintf(" order by %[1]v %[2]v, m.message_id %[2]v", createdAt, order)
+	if f.Limit > 0 {
+		query += " limit " + arg(f.Limit)
+	}
+
+	return query, args
+}
+
+func (db *DB) GetMessages(filter *MessageFilter) ([]*Message, error) {
+	query, args := filter.query()
+	messages := []*Message{}
+	err := db.Select(&messages, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// EachMessage hands messages to fn one at a time as they're read, so large
+// logs don't have to be held in memory.
+func (db *DB) EachMessage(filter *MessageFilter, fn func(*Message) error) error {
+	query, args := filter.query()
+	rows, err := db.Queryx(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &Message{}
+		if err := rows.StructScan(m); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *HTTPServer) GetMessagesForVessel(w http.ResponseWriter, r *http.Request) error {
+	mmsi, err := urlParamInt64(r, "mmsi")
+	if err != nil {
+		return err
+	}
+
+	return s.writeMessages(w, r, strconv.FormatInt(mmsi, 10), func(f *MessageFilter) {
+		f.MMSI = null.IntFrom(mmsi)
+	})
+}
+
+func (s *HTTPServer) GetMessagesForFeed(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt64(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetFeed(int(feedID)); err != nil {
+		return err
+	}
+
+	return s.writeMessages(w, r, "feed-"+strconv.FormatInt(feedID, 10), func(f *MessageFilter) {
+		f.FeedID = null.IntFrom(feedID)
+	})
+}
+
+// writeMessages returns a page of messages as JSON, or with f=nmea streams
+// every matching raw sentence, oldest first so it can be replayed, as a log
+// with TAG blocks carrying the time and feed each was received at.
+func (s *HTTPServer) writeMessages(w http.ResponseWriter, r *http.Request, filename string, scope func(*MessageFilter)) error {
+	query := r.URL.Query()
+
+	if query.Get("f") == FormatNMEA {
+		filter, err := ParseMessageFilter(query, 0)
+		if err != nil {
+			return err
+		}
+		filter.Oldest = true
+		scope(filter)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v.nmea\"", filename))
+		w.WriteHeader(http.StatusOK)
+
+		bw := bufio.NewWriter(w)
+		err = s.DB.EachMessage(filter, func(m *Message) error {
+			return writeNMEA(bw, m)
+		})
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+
+	filter, err := ParseMessageFilter(query, defaultMessageLimit)
+	if err != nil {
+		return err
+	}
+	scope(filter)
+
+	messages, err := s.DB.GetMessages(filter)
+	if err != nil {
+		return err
+	}
+
+	if filter.Limit > 0 && len(messages) == filter.Limit {
+		last := messages[len(messages)-1]
+		cursor := &MessageCursor{CreatedAt: last.CreatedAt, MessageID: last.MessageID}
+		writeNextLink(w, r, cursor.String())
+	}
+
+	writeJSON(w, http.StatusOK, messages)
+	return nil
+}
+
+// writeNMEA writes a message's sentences in the same form as packet
+// archives. Sentences that arrived with their own TAG block keep it.
+func writeNMEA(w io.Writer, m *Message) error {
+	fields := []string{"c:" + strconv.FormatInt(m.CreatedAt.UnixMilli(), 10)}
+	if m.FeedID.Valid {
+		fields = append(fields, "s:"+strconv.FormatInt(m.FeedID.Int64, 10))
+	}
+	tag := formatTagBlock(fields...)
+
+	for _, line := range strings.Split(m.Raw, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "\\") {
+			line = tag + line
+		}
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
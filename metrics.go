@@ -0,0 +1,166 @@
+package ino
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	feedLinesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "feed",
+		Name:      "lines_received_total",
+		Help:      "Lines read from the feed, valid or not.",
+	}, []string{"feed"})
+	feedBytesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "feed",
+		Name:      "bytes_received_total",
+		Help:      "Bytes read from the feed.",
+	}, []string{"feed"})
+	feedPacketsInserted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "feed",
+		Name:      "packets_inserted_total",
+		Help:      "Valid sentences stored as packets.",
+	}, []string{"feed"})
+	feedPacketErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "feed",
+		Name:      "packet_errors_total",
+		Help:      "Sentences that couldn't be validated, assembled or decoded, by reason.",
+	}, []string{"feed", "reason"})
+	feedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "feed",
+		Name:      "messages_total",
+		Help:      "Decoded messages by type, including ones another feed heard first.",
+	}, []string{"feed", "type"})
+	feedReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "feed",
+		Name:      "reconnects_total",
+		Help:      "Times the decoder has had to reconnect to the feed's repeater.",
+	}, []string{"feed"})
+
+	dbWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ino",
+		Subsystem: "db",
+		Name:      "write_duration_seconds",
+		Help:      "Time taken by ingest writes, by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	zoneEventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "zone",
+		Name:      "events_dropped_total",
+		Help:      "Zone events dropped because too many were already waiting to be written.",
+	})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ino",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ino",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route. Streams count for as long as they're open.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// observeDBWrite records how long an ingest write took. It's meant to be
+// deferred at the top of the write, or called straight after it where only
+// some messages lead to one.
+func observeDBWrite(operation string, start time.Time) {
+	dbWriteDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+func observeRequest(method string, route string, status int, duration time.Duration) {
+	if route == "" {
+		// Keep unrouted paths from each becoming their own series.
+		route = "unmatched"
+	}
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// feedMetrics are a Monstah's counters, with its feed label filled in.
+type feedMetrics struct {
+	lines      prometheus.Counter
+	bytes      prometheus.Counter
+	packets    prometheus.Counter
+	reconnects prometheus.Counter
+	errors     *prometheus.CounterVec
+	messages   *prometheus.CounterVec
+}
+
+func newFeedMetrics(feedID int) *feedMetrics {
+	feed := strconv.Itoa(feedID)
+	labels := prometheus.Labels{"feed": feed}
+	return &feedMetrics{
+		lines:      feedLinesReceived.WithLabelValues(feed),
+		bytes:      feedBytesReceived.WithLabelValues(feed),
+		packets:    feedPacketsInserted.WithLabelValues(feed),
+		reconnects: feedReconnects.WithLabelValues(feed),
+		errors:     feedPacketErrors.MustCurryWith(labels),
+		messages:   feedMessages.MustCurryWith(labels),
+	}
+}
+
+var (
+	feedConnectedDesc = prometheus.NewDesc("ino_feed_connected",
+		"Whether the decoder is connected to the feed's repeater.", []string{"feed"}, nil)
+	feedLastPacketAgeDesc = prometheus.NewDesc("ino_feed_last_packet_age_seconds",
+		"Seconds since the feed last sent a line.", []string{"feed"}, nil)
+	feedDecoderPendingDesc = prometheus.NewDesc("ino_feed_decoder_pending_sentences",
+		"Sentences handed to the decoder that haven't come out as part of a message yet.", []string{"feed"}, nil)
+	feedPendingFragmentsDesc = prometheus.NewDesc("ino_feed_pending_fragments",
+		"Multipart message fragments waiting for the rest of their message.", []string{"feed"}, nil)
+	streamSubscribersDesc = prometheus.NewDesc("ino_stream_subscribers",
+		"Clients subscribed to the live stream.", nil, nil)
+)
+
+// Describe and Collect make the manager a collector for the gauges that are
+// read from the running decoders when scraped. Goroutine counts come from
+// the Go collector that's registered by default.
+func (mm *MonstahManager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- feedConnectedDesc
+	ch <- feedLastPacketAgeDesc
+	ch <- feedDecoderPendingDesc
+	ch <- feedPendingFragmentsDesc
+	ch <- streamSubscribersDesc
+}
+
+func (mm *MonstahManager) Collect(ch chan<- prometheus.Metric) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	now := time.Now()
+	for i, m := range mm.monstahs {
+		feed := strconv.FormatInt(mm.feeds[i].FeedID, 10)
+
+		connected := 0.0
+		if m.connected.Load() {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(feedConnectedDesc, prometheus.GaugeValue, connected, feed)
+
+		if last := m.lastPacket.Load(); last != 0 {
+			age := now.Sub(time.Unix(0, last)).Seconds()
+			ch <- prometheus.MustNewConstMetric(feedLastPacketAgeDesc, prometheus.GaugeValue, age, feed)
+		}
+
+		ch <- prometheus.MustNewConstMetric(feedDecoderPendingDesc, prometheus.GaugeValue, float64(m.pending.Load()), feed)
+		ch <- prometheus.MustNewConstMetric(feedPendingFragmentsDesc, prometheus.GaugeValue, float64(m.assembler.Stats().Pending), feed)
+	}
+
+	ch <- prometheus.MustNewConstMetric(streamSubscribersDesc, prometheus.GaugeValue, float64(mm.Hub.Subscribers()))
+}
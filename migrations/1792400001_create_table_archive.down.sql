@@ -0,0 +1,3 @@
+drop index message_created_at_idx;
+drop index packet_created_at_idx;
+drop table archive;
@@ -0,0 +1,18 @@
+create table archive
+(
+    archive_id serial not null,
+    kind character varying not null,
+    day date not null,
+    path character varying not null,
+    row_count bigint not null,
+    first_id bigint not null,
+    last_id bigint not null,
+    sha256 character varying not null,
+    purged boolean not null default false,
+    created_at timestamp with time zone not null default now(),
+    constraint archive_pkey primary key (archive_id),
+    constraint archive_kind_day_key unique (kind, day)
+);
+
+create index packet_created_at_idx on packet (created_at);
+create index message_created_at_idx on message (created_at);
@@ -0,0 +1,34 @@
+drop view message_stats_by_vessel;
+create view message_stats_by_vessel as
+select
+	mmsi,
+	type,
+	count(1) count,
+	min(created_at) as first,
+	max(created_at) as last,
+	now() - max(created_at) as ago
+from
+	message
+group by
+	mmsi,
+	type
+order by
+	mmsi,
+	type;
+
+drop view message_stats;
+create view message_stats as
+select
+	type,
+	count(1) count,
+	min(created_at) as first,
+	max(created_at) as last,
+	now() - max(created_at) as ago
+from
+	message
+group by
+	type
+order by
+	type;
+
+drop table message_reception;
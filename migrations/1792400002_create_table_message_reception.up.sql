@@ -0,0 +1,71 @@
+create table message_reception
+(
+    message_reception_id serial not null,
+    message_id integer not null references message (message_id) on delete cascade,
+    feed_id integer not null references feed (feed_id),
+    created_at timestamp with time zone not null default now(),
+    constraint message_reception_pkey primary key (message_reception_id)
+);
+
+insert into message_reception (message_id, feed_id, created_at)
+select message_id, feed_id, created_at from message;
+
+create index message_reception_message_id_idx on message_reception (message_id);
+create index message_reception_feed_id_created_at_idx on message_reception (feed_id, created_at);
+
+drop view message_stats;
+create view message_stats as
+with receptions as
+(
+	select
+		message_id,
+		count(1) total
+	from
+		message_reception
+	group by
+		message_id
+)
+select
+	m.type,
+	count(1) count,
+	coalesce(sum(r.total), 0) total,
+	min(m.created_at) as first,
+	max(m.created_at) as last,
+	now() - max(m.created_at) as ago
+from
+	message m
+	left join receptions r on r.message_id = m.message_id
+group by
+	m.type
+order by
+	m.type;
+
+drop view message_stats_by_vessel;
+create view message_stats_by_vessel as
+with receptions as
+(
+	select
+		message_id,
+		count(1) total
+	from
+		message_reception
+	group by
+		message_id
+)
+select
+	m.mmsi,
+	m.type,
+	count(1) count,
+	coalesce(sum(r.total), 0) total,
+	min(m.created_at) as first,
+	max(m.created_at) as last,
+	now() - max(m.created_at) as ago
+from
+	message m
+	left join receptions r on r.message_id = m.message_id
+group by
+	m.mmsi,
+	m.type
+order by
+	m.mmsi,
+	m.type;
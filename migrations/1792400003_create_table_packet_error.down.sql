@@ -0,0 +1,2 @@
+drop index packet_feed_id_created_at_idx;
+drop table packet_error;
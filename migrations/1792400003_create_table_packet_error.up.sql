@@ -0,0 +1,13 @@
+create table packet_error
+(
+    packet_error_id serial not null,
+    feed_id integer not null references feed (feed_id),
+    raw character varying not null,
+    reason character varying not null,
+    error character varying not null,
+    created_at timestamp with time zone not null default now(),
+    constraint packet_error_pkey primary key (packet_error_id)
+);
+
+create index packet_error_feed_id_created_at_idx on packet_error (feed_id, created_at);
+create index packet_feed_id_created_at_idx on packet (feed_id, created_at);
@@ -0,0 +1,9 @@
+drop index vessel_feed_id_idx;
+drop index vessel_class_idx;
+drop index vessel_navigation_status_idx;
+drop index vessel_ship_type_idx;
+drop index vessel_updated_at_idx;
+drop index vessel_the_geog_idx;
+
+alter table vessel drop column feed_id;
+alter table vessel drop column class;
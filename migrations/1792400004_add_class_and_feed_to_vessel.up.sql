@@ -0,0 +1,30 @@
+alter table vessel add column class character varying;
+alter table vessel add column feed_id integer references feed (feed_id);
+
+update vessel v
+set
+    class = l.class,
+    feed_id = l.feed_id
+from
+(
+    select distinct on (mmsi)
+        mmsi,
+        case when type in (18, 19, 24) then 'B' else 'A' end class,
+        feed_id
+    from
+        message
+    where
+        type in (1, 2, 3, 5, 18, 19, 24)
+    order by
+        mmsi,
+        created_at desc
+) l
+where
+    l.mmsi = v.mmsi;
+
+create index vessel_the_geog_idx on vessel using gist (the_geog);
+create index vessel_updated_at_idx on vessel (updated_at);
+create index vessel_ship_type_idx on vessel (ship_type);
+create index vessel_navigation_status_idx on vessel (navigation_status);
+create index vessel_class_idx on vessel (class);
+create index vessel_feed_id_idx on vessel (feed_id);
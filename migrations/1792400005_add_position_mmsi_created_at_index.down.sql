@@ -0,0 +1 @@
+drop index position_mmsi_created_at_idx;
@@ -0,0 +1 @@
+create index position_mmsi_created_at_idx on position (mmsi, created_at, position_id);
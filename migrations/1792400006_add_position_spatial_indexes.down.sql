@@ -0,0 +1,2 @@
+drop index position_created_at_idx;
+drop index position_the_geog_idx;
@@ -0,0 +1,2 @@
+create index position_the_geog_idx on position using gist (the_geog);
+create index position_created_at_idx on position (created_at);
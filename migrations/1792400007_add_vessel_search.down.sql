@@ -0,0 +1,7 @@
+drop index vessel_imo_number_text_idx;
+drop index vessel_mmsi_text_idx;
+drop index vessel_destination_trgm_idx;
+drop index vessel_call_sign_trgm_idx;
+drop index vessel_vessel_name_trgm_idx;
+
+alter table vessel drop column imo_number;
@@ -0,0 +1,28 @@
+create extension if not exists pg_trgm;
+
+alter table vessel add column imo_number bigint;
+
+update vessel v
+set
+    imo_number = l.imo_number
+from
+(
+    select distinct on (mmsi)
+        mmsi,
+        nullif((message->>'IMONumber')::bigint, 0) imo_number
+    from
+        message
+    where
+        type = 5
+    order by
+        mmsi,
+        created_at desc
+) l
+where
+    l.mmsi = v.mmsi;
+
+create index vessel_vessel_name_trgm_idx on vessel using gin (vessel_name gin_trgm_ops);
+create index vessel_call_sign_trgm_idx on vessel using gin (call_sign gin_trgm_ops);
+create index vessel_destination_trgm_idx on vessel using gin (destination gin_trgm_ops);
+create index vessel_mmsi_text_idx on vessel ((mmsi::text) text_pattern_ops);
+create index vessel_imo_number_text_idx on vessel ((imo_number::text) text_pattern_ops);
@@ -0,0 +1 @@
+drop index message_mmsi_created_at_idx;
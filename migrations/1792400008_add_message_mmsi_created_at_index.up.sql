@@ -0,0 +1 @@
+create index message_mmsi_created_at_idx on message (mmsi, created_at, message_id);
@@ -0,0 +1,14 @@
+create table api_key
+(
+    api_key_id serial not null,
+    name character varying not null,
+    prefix character varying not null,
+    key_hash character varying not null,
+    role character varying not null check (role in ('read', 'admin')),
+    request_count bigint not null default 0,
+    last_used_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    created_at timestamp with time zone not null default now(),
+    constraint api_key_pkey primary key (api_key_id),
+    constraint api_key_key_hash_key unique (key_hash)
+);
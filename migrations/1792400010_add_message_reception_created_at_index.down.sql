@@ -0,0 +1 @@
+drop index message_reception_created_at_idx;
@@ -0,0 +1 @@
+create index message_reception_created_at_idx on message_reception (created_at);
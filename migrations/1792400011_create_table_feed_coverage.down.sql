@@ -0,0 +1,5 @@
+drop table feed_coverage_hex;
+drop table feed_coverage;
+
+alter table feed drop column longitude;
+alter table feed drop column latitude;
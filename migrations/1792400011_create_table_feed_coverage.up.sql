@@ -0,0 +1,27 @@
+alter table feed add column latitude double precision;
+alter table feed add column longitude double precision;
+
+create table feed_coverage
+(
+    feed_id integer not null references feed (feed_id) on delete cascade,
+    window_seconds integer not null,
+    positions bigint not null,
+    max_range double precision,
+    origin geometry(Point, 4326),
+    origin_estimated boolean not null default false,
+    hull geometry(Geometry, 4326),
+    sectors geometry(Geometry, 4326),
+    refreshed_at timestamp with time zone not null default now(),
+    constraint feed_coverage_pkey primary key (feed_id, window_seconds)
+);
+
+create table feed_coverage_hex
+(
+    feed_id integer not null,
+    window_seconds integer not null,
+    hex geometry(Polygon, 4326) not null,
+    receptions bigint not null,
+    constraint feed_coverage_hex_feed_coverage_fkey foreign key (feed_id, window_seconds) references feed_coverage (feed_id, window_seconds) on delete cascade
+);
+
+create index feed_coverage_hex_feed_id_window_seconds_idx on feed_coverage_hex (feed_id, window_seconds);
@@ -0,0 +1,2 @@
+drop table message_rollup_state;
+drop table message_rollup;
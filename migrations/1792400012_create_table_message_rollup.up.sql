@@ -0,0 +1,21 @@
+create table message_rollup
+(
+    resolution character varying not null check (resolution in ('minute', 'hour', 'day')),
+    bucket timestamp with time zone not null,
+    type integer not null,
+    feed_id integer not null references feed (feed_id),
+    class character varying not null,
+    receptions bigint not null,
+    messages bigint not null,
+    constraint message_rollup_pkey primary key (resolution, bucket, type, feed_id, class)
+);
+
+create table message_rollup_state
+(
+    message_rollup_state_id integer not null default 1 check (message_rollup_state_id = 1),
+    last_message_reception_id bigint not null,
+    updated_at timestamp with time zone not null default now(),
+    constraint message_rollup_state_pkey primary key (message_rollup_state_id)
+);
+
+insert into message_rollup_state (last_message_reception_id) values (0);
@@ -0,0 +1,3 @@
+drop table zone_event;
+drop table zone_occupancy;
+drop table zone;
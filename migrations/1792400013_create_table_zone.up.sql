@@ -0,0 +1,38 @@
+create table zone
+(
+    zone_id serial not null,
+    name character varying not null,
+    tags character varying[] not null default '{}',
+    the_geog geography(Geometry, 4326) not null,
+    created_at timestamp with time zone not null default now(),
+    updated_at timestamp with time zone not null default now(),
+    constraint zone_pkey primary key (zone_id)
+);
+
+create index zone_tags_idx on zone using gin (tags);
+
+create table zone_occupancy
+(
+    zone_id integer not null references zone (zone_id) on delete cascade,
+    mmsi integer not null,
+    entered_at timestamp with time zone not null,
+    last_seen_at timestamp with time zone not null,
+    dwelling boolean not null default false,
+    constraint zone_occupancy_pkey primary key (zone_id, mmsi)
+);
+
+create table zone_event
+(
+    zone_event_id serial not null,
+    zone_id integer not null references zone (zone_id) on delete cascade,
+    mmsi integer not null,
+    kind character varying not null check (kind in ('enter', 'exit', 'dwell')),
+    latitude double precision not null,
+    longitude double precision not null,
+    entered_at timestamp with time zone not null,
+    created_at timestamp with time zone not null default now(),
+    constraint zone_event_pkey primary key (zone_event_id)
+);
+
+create index zone_event_zone_id_created_at_idx on zone_event (zone_id, created_at);
+create index zone_event_mmsi_created_at_idx on zone_event (mmsi, created_at);
@@ -0,0 +1,3 @@
+drop table alert_delivery_attempt;
+drop table alert_delivery;
+drop table alert_rule;
@@ -0,0 +1,44 @@
+create table alert_rule
+(
+    alert_rule_id serial not null,
+    name character varying not null,
+    kind character varying not null check (kind in ('watchlist', 'zone_enter', 'nav_status', 'speed')),
+    conditions jsonb not null default '{}',
+    webhook_url character varying not null,
+    secret character varying not null,
+    cooldown_seconds integer not null default 600,
+    active boolean not null default true,
+    created_at timestamp with time zone not null default now(),
+    updated_at timestamp with time zone not null default now(),
+    constraint alert_rule_pkey primary key (alert_rule_id)
+);
+
+create table alert_delivery
+(
+    alert_delivery_id serial not null,
+    alert_rule_id integer not null references alert_rule (alert_rule_id) on delete cascade,
+    payload jsonb not null,
+    status character varying not null default 'pending' check (status in ('pending', 'delivered', 'failed')),
+    attempts integer not null default 0,
+    next_attempt_at timestamp with time zone not null default now(),
+    delivered_at timestamp with time zone,
+    created_at timestamp with time zone not null default now(),
+    constraint alert_delivery_pkey primary key (alert_delivery_id)
+);
+
+create index alert_delivery_pending_idx on alert_delivery (next_attempt_at) where status = 'pending';
+create index alert_delivery_alert_rule_id_created_at_idx on alert_delivery (alert_rule_id, created_at);
+
+create table alert_delivery_attempt
+(
+    alert_delivery_attempt_id serial not null,
+    alert_delivery_id integer not null references alert_delivery (alert_delivery_id) on delete cascade,
+    attempt integer not null,
+    status_code integer,
+    error character varying,
+    duration_ms integer not null,
+    created_at timestamp with time zone not null default now(),
+    constraint alert_delivery_attempt_pkey primary key (alert_delivery_attempt_id)
+);
+
+create index alert_delivery_attempt_alert_delivery_id_idx on alert_delivery_attempt (alert_delivery_id);
@@ -0,0 +1,4 @@
+drop table voyage_state;
+drop table voyage_track;
+drop table voyage;
+drop table port_call;
@@ -0,0 +1,57 @@
+create table port_call
+(
+    port_call_id serial not null,
+    mmsi integer not null,
+    zone_id integer references zone (zone_id) on delete set null,
+    kind character varying not null check (kind in ('port', 'anchorage')),
+    latitude double precision not null,
+    longitude double precision not null,
+    arrived_at timestamp with time zone not null,
+    departed_at timestamp with time zone,
+    created_at timestamp with time zone not null default now(),
+    constraint port_call_pkey primary key (port_call_id)
+);
+
+create index port_call_mmsi_arrived_at_idx on port_call (mmsi, arrived_at);
+create index port_call_zone_id_arrived_at_idx on port_call (zone_id, arrived_at);
+
+create table voyage
+(
+    voyage_id serial not null,
+    mmsi integer not null,
+    origin_port_call_id integer references port_call (port_call_id) on delete set null,
+    destination_port_call_id integer references port_call (port_call_id) on delete set null,
+    departed_at timestamp with time zone not null,
+    arrived_at timestamp with time zone,
+    distance double precision not null default 0,
+    max_speed double precision not null default 0,
+    positions integer not null default 0,
+    created_at timestamp with time zone not null default now(),
+    constraint voyage_pkey primary key (voyage_id)
+);
+
+create index voyage_mmsi_departed_at_idx on voyage (mmsi, departed_at);
+
+create table voyage_track
+(
+    mmsi integer not null,
+    voyage_id integer references voyage (voyage_id) on delete set null,
+    port_call_id integer references port_call (port_call_id) on delete set null,
+    stopped_since timestamp with time zone,
+    stopped_latitude double precision,
+    stopped_longitude double precision,
+    last_latitude double precision,
+    last_longitude double precision,
+    last_at timestamp with time zone,
+    constraint voyage_track_pkey primary key (mmsi)
+);
+
+create table voyage_state
+(
+    voyage_state_id integer not null default 1 check (voyage_state_id = 1),
+    last_message_id bigint not null,
+    updated_at timestamp with time zone not null default now(),
+    constraint voyage_state_pkey primary key (voyage_state_id)
+);
+
+insert into voyage_state (last_message_id) values (0);
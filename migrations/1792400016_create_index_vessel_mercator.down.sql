@@ -0,0 +1 @@
+drop index vessel_the_geom_3857_idx;
@@ -0,0 +1,4 @@
+-- Tiles are cut in web mercator, which can't represent the poles, so only
+-- vessels it can show are indexed.
+create index vessel_the_geom_3857_idx on vessel using gist (ST_Transform(the_geog::geometry, 3857))
+    where ST_Y(the_geog::geometry) between -85.0511 and 85.0511;
@@ -6,28 +6,57 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ralreegorganon/nmeaais"
 	"github.com/ralreegorganon/rudia"
 )
 
+// dedupWaitTimeout bounds how long a duplicate waits for the feed that heard
+// it first to finish storing the canonical message.
+const dedupWaitTimeout = 5 * time.Second
+
 type Monstah struct {
-	feedID int
-	r      *rudia.Repeater
-	d      *nmeaais.Decoder
-	DB     *DB
+	feedID    int
+	r         *rudia.Repeater
+	d         *nmeaais.Decoder
+	assembler *FragmentAssembler
+	dedup     *Deduplicator
+	hub       *Hub
+	metrics   *feedMetrics
+	DB        *DB
+
+	// connected, reconnects, lastPacket (in Unix nanoseconds) and pending,
+	// the number of sentences inside the decoder, are read by the metrics
+	// collector and feed status.
+	connected  atomic.Bool
+	reconnects atomic.Int64
+	lastPacket atomic.Int64
+	pending    atomic.Int64
+
+	mu       sync.Mutex
+	stopping bool
+	done     chan struct{}
+	conn     net.Conn
+	wg       sync.WaitGroup
 }
 
-func NewMonstah(db *DB) *Monstah {
+func NewMonstah(db *DB, dedup *Deduplicator, hub *Hub, options *MonstahOptions) *Monstah {
 	m := &Monstah{
 		r: rudia.NewRepeater(&rudia.RepeaterOptions{
 			UpstreamProxyIdleTimeout:    time.Duration(600) * time.Second,
 			UpstreamListenerIdleTimeout: time.Duration(600) * time.Second,
 			RetryInterval:               time.Duration(10) * time.Second,
 		}),
-		d:  nmeaais.NewDecoder(),
-		DB: db,
+		d:         nmeaais.NewDecoder(),
+		assembler: NewFragmentAssembler(options.FragmentTimeout),
+		dedup:     dedup,
+		hub:       hub,
+		DB:        db,
+		done:      make(chan struct{}),
 	}
 	return m
 }
@@ -43,6 +72,7 @@ func (m *Monstah) Decode(address string) {
 	}
 
 	m.feedID = feedID
+	m.metrics = newFeedMetrics(feedID)
 
 	m.r.Proxy(address)
 
@@ -61,60 +91,158 @@ func (m *Monstah) Decode(address string) {
 	}
 
 	go m.r.ListenAndAcceptClients(port)
-	go m.receive(port)
 	go m.postprocess()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return
+	}
+	m.wg.Add(2)
+	go m.receive(port)
+	go m.expireFragments()
 }
 
+// Shutdown stops decoding. Nothing more is fed to the decoder once it
+// returns, so the feed can be stopped while the rest of ino keeps running.
 func (m *Monstah) Shutdown() {
 	slog.Info("Shutting down decoder")
+
+	m.mu.Lock()
+	m.stopping = true
+	close(m.done)
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
 	close(m.d.Input)
 	m.r.Shutdown()
 }
 
+// track remembers the loopback connection so Shutdown can interrupt a read,
+// refusing it if Shutdown has already happened.
+func (m *Monstah) track(conn net.Conn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return false
+	}
+	m.conn = conn
+	return true
+}
+
 func (m *Monstah) receive(address string) {
+	defer m.wg.Done()
 	retryInterval := 10 * time.Second
-	fault := make(chan bool)
-	for {
+	for dialed := false; ; dialed = true {
+		if dialed {
+			m.reconnects.Add(1)
+			m.metrics.reconnects.Inc()
+		}
 		slog.Info("Dialing upstream", "upstream", address)
 
 		conn, err := net.Dial("tcp", address)
 		if err != nil {
 			slog.Error("Error dialing upstream", "upstream", address, slog.Any("error", err))
 			slog.Info("Sleeping before retrying upstream", "upstream", address, "sleep", retryInterval)
-			time.Sleep(retryInterval)
-			continue
+			select {
+			case <-time.After(retryInterval):
+				continue
+			case <-m.done:
+				return
+			}
 		}
+		if !m.track(conn) {
+			conn.Close()
+			return
+		}
+
+		m.connected.Store(true)
 
 		r := bufio.NewReader(conn)
 
 		for {
 			line, err := r.ReadString('\n')
 			if err != nil {
-				slog.Error("Couldn't read packet", slog.Any("error", err))
-				fault <- true
+				select {
+				case <-m.done:
+				default:
+					slog.Error("Couldn't read packet", slog.Any("error", err))
+				}
 				break
 			}
+
+			now := time.Now()
+			m.lastPacket.Store(now.UnixNano())
+			m.metrics.lines.Inc()
+			m.metrics.bytes.Add(float64(len(line)))
+
+			if reason, err := validateSentence(line); err != nil {
+				m.packetError(line, reason, err)
+				continue
+			}
 			err = m.DB.AddPacket(line, m.feedID)
 			if err != nil {
 				slog.Error("Couldn't insert packet to database", slog.Any("error", err))
 				continue
 			}
-			m.d.Input <- nmeaais.DecoderInput{
-				Input:     line,
-				Timestamp: time.Now(),
+			m.metrics.packets.Inc()
+
+			lines, dropped := m.assembler.Add(line, now)
+			for _, d := range dropped {
+				m.packetError(d.line, d.reason, d.err)
+			}
+			for _, l := range lines {
+				m.pending.Add(1)
+				m.d.Input <- nmeaais.DecoderInput{
+					Input:     l,
+					Timestamp: now,
+				}
 			}
 		}
-		<-fault
+		m.connected.Store(false)
 		conn.Close()
+
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+	}
+}
+
+// expireFragments reports the fragments of messages that never completed,
+// which otherwise wouldn't be noticed until the feed sent another line.
+func (m *Monstah) expireFragments() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(max(m.assembler.timeout, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			for _, d := range m.assembler.Expire(now) {
+				m.packetError(d.line, d.reason, d.err)
+			}
+		}
 	}
 }
 
 func (m *Monstah) postprocess() {
 	for o := range m.d.Output {
+		m.pending.Add(-int64(len(o.SourcePackets)))
+
 		if o.Error != nil {
 			slog.Error("Couldn't decode message", "message", o.SourceMessage, slog.Any("error", o.Error))
+			m.packetError(joinRaw(o.SourcePackets), PacketErrorDecode, o.Error)
 			continue
 		}
+		m.metrics.messages.WithLabelValues(strconv.FormatInt(o.SourceMessage.MessageType, 10)).Inc()
 
 		message, err := json.Marshal(o.DecodedMessage)
 		if err != nil {
@@ -122,24 +250,64 @@ func (m *Monstah) postprocess() {
 			message = []byte("{}")
 		}
 
-		var rawBuf bytes.Buffer
-		length := len(o.SourcePackets)
-		for i, p := range o.SourcePackets {
-			rawBuf.WriteString(p.Raw)
-			if i+1 != length {
-				rawBuf.WriteString("\n")
-			}
+		raw := []byte(joinRaw(o.SourcePackets))
+
+		claim, first := m.dedup.Claim(hashPayload(o.SourcePackets), o.Timestamp)
+		if !first {
+			// Waiting on the feed that heard it first mustn't hold up the
+			// rest of this feed's messages.
+			go m.duplicate(claim, o, message, raw)
+			continue
 		}
 
-		raw := rawBuf.Bytes()
+		claim.Resolve(m.store(o, message, raw))
+	}
+}
 
-		err = m.DB.AddMessage(o.SourceMessage.MMSI, o.SourceMessage.MessageType, message, raw, m.feedID)
-		if err != nil {
-			slog.Error("Couldn't insert message to database", "message", message, slog.Any("error", err))
-			continue
+// duplicate records another reception of a message a different feed heard
+// first, once that feed has stored it. If it couldn't, or takes too long,
+// the message is stored from this feed instead.
+func (m *Monstah) duplicate(claim *DedupClaim, o nmeaais.DecoderOutput, message []byte, raw []byte) {
+	if messageID, ok := claim.Wait(dedupWaitTimeout); ok {
+		if err := m.DB.AddMessageReception(messageID, m.feedID); err != nil {
+			slog.Error("Couldn't insert message reception to database", "messageId", messageID, slog.Any("error", err))
 		}
+		return
+	}
+	m.store(o, message, raw)
+}
+
+// store saves a message and passes it on, returning its id, or zero if it
+// couldn't be saved.
+func (m *Monstah) store(o nmeaais.DecoderOutput, message []byte, raw []byte) int64 {
+	messageID, err := m.DB.AddMessage(o.SourceMessage.MMSI, o.SourceMessage.MessageType, message, raw, m.feedID)
+	if err != nil {
+		slog.Error("Couldn't insert message to database", "message", message, slog.Any("error", err))
+		return 0
+	}
+
+	go m.DB.UpdateVessel(o, m.feedID)
+	go m.DB.UpdatePosition(o)
+	m.hub.Publish(o)
+	return messageID
+}
 
-		go m.DB.UpdateVessel(o)
-		go m.DB.UpdatePosition(o)
+// packetError stores a line that couldn't be used, and counts it.
+func (m *Monstah) packetError(raw string, reason string, cause error) {
+	m.metrics.errors.WithLabelValues(reason).Inc()
+	if err := m.DB.AddPacketError(raw, m.feedID, reason, cause); err != nil {
+		slog.Error("Couldn't insert packet error to database", slog.Any("error", err))
+	}
+}
+
+func joinRaw(packets []*nmeaais.Packet) string {
+	var rawBuf bytes.Buffer
+	length := len(packets)
+	for i, p := range packets {
+		rawBuf.WriteString(p.Raw)
+		if i+1 != length {
+			rawBuf.WriteString("\n")
+		}
 	}
+	return rawBuf.String()
 }
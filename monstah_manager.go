@@ -1,33 +1,130 @@
 package ino
 
+import (
+	"sync"
+	"time"
+)
+
+type MonstahOptions struct {
+	// DedupWindow is how long after a transmission is first heard that the
+	// same payload from another feed is treated as a duplicate.
+	DedupWindow time.Duration
+	// FragmentTimeout is how long the fragments of a multipart message are
+	// held waiting for the rest before they're given up on.
+	FragmentTimeout time.Duration
+}
+
 type MonstahManager struct {
+	mu       sync.Mutex
+	feeds    []*Feed
 	monstahs []*Monstah
+	options  MonstahOptions
+	dedup    *Deduplicator
+	Hub      *Hub
 	DB       *DB
 }
 
-func NewMonstahManager(db *DB) (*MonstahManager, error) {
+// NewMonstahManager starts decoding every active feed.
+func NewMonstahManager(db *DB, options *MonstahOptions) (*MonstahManager, error) {
 	feeds, err := db.GetFeeds()
 	if err != nil {
 		return nil, err
 	}
 
-	monstahs := make([]*Monstah, len(feeds))
-	for i, feed := range feeds {
-		m := NewMonstah(db)
-		go m.Decode(feed.RemoteAddress)
-		monstahs[i] = m
+	mm := &MonstahManager{
+		options: *options,
+		dedup:   NewDeduplicator(options.DedupWindow),
+		Hub:     NewHub(),
+		DB:      db,
 	}
 
-	mm := &MonstahManager{
-		monstahs: monstahs,
-		DB:       db,
+	for _, feed := range feeds {
+		if feed.Active {
+			mm.start(feed)
+		}
 	}
 
 	return mm, nil
 }
 
+// start begins decoding a feed. Callers hold mu, or haven't shared mm yet.
+func (mm *MonstahManager) start(feed *Feed) {
+	m := NewMonstah(mm.DB, mm.dedup, mm.Hub, &mm.options)
+	go m.Decode(feed.RemoteAddress)
+	mm.feeds = append(mm.feeds, feed)
+	mm.monstahs = append(mm.monstahs, m)
+}
+
+// stop stops decoding a feed if it's running. Callers hold mu.
+func (mm *MonstahManager) stop(feedID int64) {
+	for i, feed := range mm.feeds {
+		if feed.FeedID != feedID {
+			continue
+		}
+		mm.monstahs[i].Shutdown()
+		mm.feeds = append(mm.feeds[:i], mm.feeds[i+1:]...)
+		mm.monstahs = append(mm.monstahs[:i], mm.monstahs[i+1:]...)
+		return
+	}
+}
+
+// AddFeed stores a new feed and starts decoding it.
+func (mm *MonstahManager) AddFeed(remoteAddress string) (*Feed, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	feeds, err := mm.DB.GetFeeds()
+	if err != nil {
+		return nil, err
+	}
+	for _, feed := range feeds {
+		if feed.RemoteAddress == remoteAddress {
+			return nil, conflictf("ino: feed %v already has address %v", feed.FeedID, remoteAddress)
+		}
+	}
+
+	feed, err := mm.DB.AddFeed(remoteAddress)
+	if err != nil {
+		return nil, err
+	}
+	mm.start(feed)
+	return feed, nil
+}
+
+// SetFeedActive starts or stops decoding a feed and remembers the choice
+// across restarts. Stopped feeds keep their history.
+func (mm *MonstahManager) SetFeedActive(feedID int, active bool) (*Feed, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	feed, err := mm.DB.SetFeedActive(feedID, active)
+	if err != nil {
+		return nil, err
+	}
+
+	mm.stop(feed.FeedID)
+	if active {
+		mm.start(feed)
+	}
+	return feed, nil
+}
+
 func (mm *MonstahManager) Shutdown() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
 	for _, m := range mm.monstahs {
 		m.Shutdown()
 	}
 }
+
+func (mm *MonstahManager) FragmentStats() []FragmentStats {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	stats := make([]FragmentStats, len(mm.monstahs))
+	for i, m := range mm.monstahs {
+		stats[i] = m.assembler.Stats()
+		stats[i].FeedID = int(mm.feeds[i].FeedID)
+		stats[i].RemoteAddress = mm.feeds[i].RemoteAddress
+	}
+	return stats
+}
@@ -0,0 +1,285 @@
+package ino
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/guregu/null/v5"
+)
+
+const (
+	metersPerNauticalMile = 1852
+	defaultNearLimit      = 100
+	defaultNeighborLimit  = 10
+	maxNearLimit          = 1000
+)
+
+// NearQuery looks for the vessels closest to a point, optionally only those
+// within a radius and matching a VesselFilter.
+type NearQuery struct {
+	Latitude  float64
+	Longitude float64
+	// Radius is in meters.
+	Radius null.Float
+	Limit  int
+	// ExcludeMMSI leaves a vessel out of the results, such as the one whose
+	// neighbors are being looked for.
+	ExcludeMMSI int64
+	Filter      *VesselFilter
+}
+
+// NearVessel is a vessel with its distance in meters and compass bearing in
+// degrees from the point it was searched from.
+type NearVessel struct {
+	Vessel
+	Distance float64    `json:"distance" db:"distance"`
+	Bearing  null.Float `json:"bearing" db:"bearing"`
+}
+
+// parseNearQuery reads the parts of a NearQuery shared by both endpoints:
+//
+//	radius=<nautical miles>
+//	limit=<count>
+//
+// along with any of the vessel list's filters.
+func parseNearQuery(q url.Values, defaultLimit int) (*NearQuery, error) {
+	filter, err := ParseVesselFilter(q)
+	if err != nil {
+		return nil, err
+	}
+
+	nq := &NearQuery{
+		Limit:  defaultLimit,
+		Filter: filter,
+	}
+
+	if v := q.Get("radius"); v != "" {
+		nm, err := strconv.ParseFloat(v, 64)
+		if err != nil || nm <= 0 {
+			return nil, badRequestf("ino: invalid radius '%v'", v)
+		}
+		nq.Radius = null.FloatFrom(nm * metersPerNauticalMile)
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxNearLimit {
+			return nil, badRequestf("ino: invalid limit '%v', must be between 1 and %v", v, maxNearLimit)
+		}
+		nq.Limit = limit
+	}
+
+	return nq, nil
+}
+
+// query renders the search around the given select list. The nearest
+// vessels are found with a KNN ordering on the_geog so the GiST index does
+// the work.
+func (nq *NearQuery) query(selectList string) (string, []interface{}) {
+	where, args := nq.Filter.where()
+	n := len(args)
+	args = append(args, nq.Longitude, nq.Latitude, nq.Radius, nq.ExcludeMMSI, nq.Limit)
+
+	if where == "" {
+		where = "where true"
+	}
+
+	query := fmt.Sprintf(`
+		with
+		reference as
+		(
+			select ST_SetSRID(ST_MakePoint($%[2]d, $%[3]d), 4326)::geography reference_geog
+		),
+		near as
+		(
+			select
+				vessel.*,
+				ST_Distance(the_geog, reference_geog) distance,
+				degrees(ST_Azimuth(reference_geog, the_geog)) bearing
+			from
+				vessel,
+				reference
+			%[1]s
+				and the_geog is not null
+				and ($%[4]d::double precision is null or ST_DWithin(the_geog, reference_geog, $%[4]d))
+				and mmsi <> $%[5]d
+			order by
+				the_geog <-> reference_geog
+			limit $%[6]d
+		)
+		%[7]s
+	`, where, n+1, n+2, n+3, n+4, n+5, selectList)
+
+	return query, args
+}
+
+func (db *DB) GetVesselsNear(nq *NearQuery) ([]*NearVessel, error) {
+	query, args := nq.query(`
+		select
+			mmsi,
+			vessel_name,
+			call_sign,
+			ship_type,
+			length,
+			breadth,
+			draught,
+			latitude,
+			longitude,
+			speed_over_ground,
+			true_heading,
+			course_over_ground,
+			navigation_status,
+			destination,
+			imo_number,
+			class,
+			feed_id,
+			updated_at,
+			distance,
+			bearing
+		from
+			near
+		order by
+			distance
+	`)
+
+	vessels := []*NearVessel{}
+	err := db.Select(&vessels, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return vessels, nil
+}
+
+func (db *DB) GetVesselsNearGeojson(nq *NearQuery) ([]byte, error) {
+	query, args := nq.query(`
+		select
+			json_build_object(
+				'type', 'FeatureCollection',
+				'features', coalesce(json_agg(json_build_object(
+					'type', 'Feature',
+					'geometry', st_asgeojson(the_geog)::json,
+					'properties', json_build_object(
+						'mmsi', mmsi,
+						'vesselName', vessel_name,
+						'callSign', call_sign,
+						'shipType', ship_type,
+						'length', length,
+						'breadth', breadth,
+						'draught', draught,
+						'speedOverGround', speed_over_ground,
+						'trueHeading', true_heading,
+						'courseOverGround', course_over_ground,
+						'navigationStatus', navigation_status,
+						'destination', destination,
+						'imoNumber', imo_number,
+						'class', class,
+						'feedId', feed_id,
+						'updatedAt', updated_at,
+						'distance', distance,
+						'bearing', bearing
+					)
+				) order by distance), '[]')
+			) geojson
+		from
+			near
+	`)
+
+	var geojson []byte
+	err := db.QueryRow(query, args...).Scan(&geojson)
+	if err != nil {
+		return nil, err
+	}
+	return geojson, nil
+}
+
+func (s *HTTPServer) GetVesselsNear(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+
+	nq, err := parseNearQuery(query, defaultNearLimit)
+	if err != nil {
+		return err
+	}
+
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return badRequestf("ino: invalid lat '%v'", query.Get("lat"))
+	}
+	lon, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return badRequestf("ino: invalid lon '%v'", query.Get("lon"))
+	}
+	nq.Latitude = lat
+	nq.Longitude = lon
+
+	return s.writeNear(w, r, nq)
+}
+
+func (s *HTTPServer) GetVesselNeighbors(w http.ResponseWriter, r *http.Request) error {
+	mmsi, err := urlParamInt(r, "mmsi")
+	if err != nil {
+		return err
+	}
+
+	nq, err := parseNearQuery(r.URL.Query(), defaultNeighborLimit)
+	if err != nil {
+		return err
+	}
+
+	vessel, err := s.DB.GetVessel(mmsi)
+	if err != nil {
+		return err
+	}
+	if !vessel.Latitude.Valid || !vessel.Longitude.Valid {
+		return notFoundf("ino: vessel %v has no known position", mmsi)
+	}
+	nq.Latitude = vessel.Latitude.Float64
+	nq.Longitude = vessel.Longitude.Float64
+	nq.ExcludeMMSI = vessel.MMSI
+
+	return s.writeNear(w, r, nq)
+}
+
+func (s *HTTPServer) writeNear(w http.ResponseWriter, r *http.Request, nq *NearQuery) error {
+	format, err := responseFormat(r)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatGeoJSON {
+		geojson, err := s.DB.GetVesselsNearGeojson(nq)
+		if err != nil {
+			return err
+		}
+
+		writeGeoJSON(w, http.StatusOK, geojson)
+		return nil
+	}
+
+	vessels, err := s.DB.GetVesselsNear(nq)
+	if err != nil {
+		return err
+	}
+
+	// KML and GPX have nowhere to put the distance, so they get the plain
+	// vessels, still nearest first.
+	plain := make([]*Vessel, len(vessels))
+	for i, v := range vessels {
+		plain[i] = &v.Vessel
+	}
+
+	switch format {
+	case FormatKML:
+		return writeExport(w, format, "vessels", func(out io.Writer) error { return renderVesselsKML(out, plain) })
+	case FormatGPX:
+		return writeExport(w, format, "vessels", func(out io.Writer) error { return renderVesselsGPX(out, plain) })
+	case FormatCSV:
+		return writeExport(w, format, "vessels", func(out io.Writer) error { return renderNearVesselsCSV(out, vessels) })
+	default:
+		writeJSON(w, http.StatusOK, vessels)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package ino
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var errTagBlockChecksum = errors.New("ino: tag block checksum mismatch")
+
+// nmeaChecksum returns the two digit hex XOR checksum NMEA 0183 uses for
+// both sentences and TAG blocks.
+func nmeaChecksum(s string) string {
+	var checksum uint8
+	for i := 0; i < len(s); i++ {
+		checksum ^= s[i]
+	}
+	return strings.ToUpper(hex.EncodeToString([]byte{checksum}))
+}
+
+// formatTagBlock renders fields such as "c:1526337970" as a NMEA 4.10 TAG
+// block, including the surrounding backslashes and the checksum.
+func formatTagBlock(fields ...string) string {
+	body := strings.Join(fields, ",")
+	return "\\" + body + "*" + nmeaChecksum(body) + "\\"
+}
+
+// parseTagBlock splits a leading TAG block off of a line, returning its
+// fields keyed by parameter code and the remainder of the line. Lines without
+// a TAG block are returned untouched with no fields.
+func parseTagBlock(line string) (map[string]string, string, error) {
+	if !strings.HasPrefix(line, "\\") {
+		return nil, line, nil
+	}
+
+	end := strings.Index(line[1:], "\\")
+	if end == -1 {
+		return nil, line, errors.New("ino: unterminated tag block")
+	}
+	block := line[1 : end+1]
+	rest := line[end+2:]
+
+	body, checksum, ok := strings.Cut(block, "*")
+	if !ok {
+		return nil, line, errors.New("ino: tag block missing checksum")
+	}
+	if !strings.EqualFold(nmeaChecksum(body), checksum) {
+		return nil, line, errTagBlockChecksum
+	}
+
+	fields := make(map[string]string)
+	for _, f := range strings.Split(body, ",") {
+		k, v, ok := strings.Cut(f, ":")
+		if !ok {
+			return nil, line, errors.New("ino: malformed tag block field")
+		}
+		fields[k] = v
+	}
+
+	return fields, rest, nil
+}
@@ -0,0 +1,357 @@
+package ino
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openAPISpec documents every route registered by CreateRouter. It's served
+// as is, and CreateRouter refuses to start if the two drift apart.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI is the parsed specification, enough of it to check routes and
+// validate responses against their schemas.
+type OpenAPI struct {
+	doc map[string]interface{}
+}
+
+// OpenAPIOperation is one method on one path of the specification.
+type OpenAPIOperation struct {
+	Method      string
+	Path        string
+	OperationID string
+	op          map[string]interface{}
+}
+
+func LoadOpenAPI() (*OpenAPI, error) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		return nil, fmt.Errorf("ino: couldn't parse the OpenAPI spec: %w", err)
+	}
+	return &OpenAPI{doc: doc}, nil
+}
+
+// Operations lists the specification's operations, sorted by path.
+func (o *OpenAPI) Operations() []OpenAPIOperation {
+	var ops []OpenAPIOperation
+	paths, _ := o.doc["paths"].(map[string]interface{})
+	for path, item := range paths {
+		methods, _ := item.(map[string]interface{})
+		for method, v := range methods {
+			op, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			id, _ := op["operationId"].(string)
+			ops = append(ops, OpenAPIOperation{
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				OperationID: id,
+				op:          op,
+			})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// Skip reports whether the operation can't be exercised with a plain
+// request and response, such as the live streams.
+func (op OpenAPIOperation) Skip() bool {
+	skip, _ := op.op["x-contract-skip"].(bool)
+	return skip
+}
+
+// Parameters returns the operation's parameters of the given kind, path or
+// query, along with each one's example value, if it has one.
+func (o *OpenAPI) Parameters(op OpenAPIOperation, in string, requiredOnly bool) map[string]interface{} {
+	found := map[string]interface{}{}
+	params, _ := op.op["parameters"].([]interface{})
+	for _, p := range params {
+		param := o.resolve(p)
+		if param["in"] != in {
+			continue
+		}
+		if required, _ := param["required"].(bool); requiredOnly && !required {
+			continue
+		}
+		found[param["name"].(string)] = param["example"]
+	}
+	return found
+}
+
+// ContractPathValues are the path parameters to exercise every operation
+// with: the vessel and feed given, message type 1 and the whole world tile.
+func ContractPathValues(mmsi int64, feedID int64) map[string]string {
+	return map[string]string{
+		"mmsi": strconv.FormatInt(mmsi, 10),
+		"id":   strconv.FormatInt(feedID, 10),
+		"type": "1",
+		"z":    "0",
+		"x":    "0",
+		"y":    "0",
+	}
+}
+
+// ExampleURL is a request for the operation on the server at baseURL, with
+// its path parameters filled in from pathValues and its required query
+// parameters set to their examples.
+func (o *OpenAPI) ExampleURL(op OpenAPIOperation, baseURL string, pathValues map[string]string) string {
+	path := op.Path
+	for name := range o.Parameters(op, "path", false) {
+		path = strings.ReplaceAll(path, "{"+name+"}", pathValues[name])
+	}
+	query := url.Values{}
+	for name, example := range o.Parameters(op, "query", true) {
+		query.Set(name, fmt.Sprint(example))
+	}
+	u := baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// CheckContract makes a GET request for the operation and validates the
+// response, returning its status.
+func (o *OpenAPI) CheckContract(client *http.Client, op OpenAPIOperation, u string, header http.Header) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%v %v: %w", op.Method, op.Path, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%v %v: %w", op.Method, op.Path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("%v %v: %w", op.Method, op.Path, err)
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, o.ValidateResponse(op, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+}
+
+// ValidateResponse checks a response against what the operation declares
+// for its status and content type. JSON bodies are checked against their
+// schema; other content types only need to be declared.
+func (o *OpenAPI) ValidateResponse(op OpenAPIOperation, status int, contentType string, body []byte) error {
+	responses, _ := op.op["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(status)]
+	if !ok && status >= http.StatusInternalServerError {
+		response, ok = responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%v %v: status %v isn't declared", op.Method, op.Path, status)
+	}
+
+	content, _ := o.resolve(response)["content"].(map[string]interface{})
+	if len(content) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%v %v: invalid content type '%v'", op.Method, op.Path, contentType)
+	}
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%v %v: content type %v isn't declared for status %v", op.Method, op.Path, mediaType, status)
+	}
+
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%v %v: body isn't JSON: %w", op.Method, op.Path, err)
+	}
+
+	if problems := o.validate(media["schema"], value, "$"); len(problems) > 0 {
+		return fmt.Errorf("%v %v: %v", op.Method, op.Path, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (o *OpenAPI) resolve(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	for {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		m = o.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, _ = m[part].(map[string]interface{})
+		}
+	}
+}
+
+// validate covers the subset of JSON Schema the specification uses.
+func (o *OpenAPI) validate(s interface{}, value interface{}, at string) []string {
+	schema := o.resolve(s)
+	if schema == nil {
+		return nil
+	}
+
+	var problems []string
+
+	for _, sub := range asSlice(schema["allOf"]) {
+		problems = append(problems, o.validate(sub, value, at)...)
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		return append(problems, fmt.Sprintf("%v should be %v", at, t))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%v isn't one of %v", at, enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, r := range asSlice(schema["required"]) {
+			if _, ok := v[r.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%v is missing %v", at, r))
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, prop := range properties {
+			if pv, ok := v[name]; ok {
+				problems = append(problems, o.validate(prop, pv, at+"."+name)...)
+			}
+		}
+		if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			for name, pv := range v {
+				if _, ok := properties[name]; !ok {
+					problems = append(problems, o.validate(additional, pv, at+"."+name)...)
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				problems = append(problems, o.validate(items, item, fmt.Sprintf("%v[%v]", at, i))...)
+			}
+		}
+	}
+
+	return problems
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	types := asSlice(t)
+	if s, ok := t.(string); ok {
+		types = []interface{}{s}
+	}
+	for _, t := range types {
+		switch t {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := value.(float64); ok && f == float64(int64(f)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+var chiParam = regexp.MustCompile(`\{([A-Za-z_]+):[^}]*\}`)
+
+// checkRoutes makes sure every route is documented and everything documented
+// is routed. OPTIONS is left to CORS.
+func (o *OpenAPI) checkRoutes(routes map[string]map[string]HTTPApiFunc) error {
+	documented := map[string]bool{}
+	for _, op := range o.Operations() {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	var problems []string
+	for method, paths := range routes {
+		if method == http.MethodOptions {
+			continue
+		}
+		for route := range paths {
+			key := method + " " + chiParam.ReplaceAllString(route, "{$1}")
+			if !documented[key] {
+				problems = append(problems, key+" isn't in the OpenAPI spec")
+			}
+			delete(documented, key)
+		}
+	}
+	for key := range documented {
+		problems = append(problems, key+" is in the OpenAPI spec but isn't routed")
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("ino: routes and OpenAPI spec disagree: %v", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func (s *HTTPServer) GetOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	writeJSONDirect(w, http.StatusOK, openAPISpec)
+	return nil
+}
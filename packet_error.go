@@ -0,0 +1,176 @@
+package ino
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// PacketErrorChecksum is a sentence or TAG block whose checksum doesn't match.
+	PacketErrorChecksum = "checksum"
+	// PacketErrorMalformed is a line that isn't structurally a NMEA sentence.
+	PacketErrorMalformed = "malformed"
+	// PacketErrorUnsupported is a well formed sentence we don't decode.
+	PacketErrorUnsupported = "unsupported"
+	// PacketErrorDecode is a sentence that passed validation but couldn't be
+	// assembled or decoded into a message.
+	PacketErrorDecode = "decode"
+
+	defaultPacketErrorLimit = 100
+	maxPacketErrorLimit     = 1000
+)
+
+type PacketError struct {
+	PacketErrorID int64     `json:"packetErrorId" db:"packet_error_id"`
+	FeedID        int64     `json:"feedId" db:"feed_id"`
+	Raw           string    `json:"raw" db:"raw"`
+	Reason        string    `json:"reason" db:"reason"`
+	Error         string    `json:"error" db:"error"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+}
+
+// validateSentence checks that a line is a checksummed AIS sentence, with an
+// optional leading TAG block, before it's stored or handed to the decoder.
+// Failures return the PacketError reason alongside the error.
+func validateSentence(line string) (string, error) {
+	line = strings.TrimSpace(line)
+
+	_, sentence, err := parseTagBlock(line)
+	if err != nil {
+		if errors.Is(err, errTagBlockChecksum) {
+			return PacketErrorChecksum, err
+		}
+		return PacketErrorMalformed, err
+	}
+
+	if !strings.HasPrefix(sentence, "!") && !strings.HasPrefix(sentence, "$") {
+		return PacketErrorMalformed, errors.New("ino: missing start delimiter")
+	}
+
+	i := strings.LastIndex(sentence, "*")
+	if i == -1 || len(sentence) != i+3 {
+		return PacketErrorMalformed, errors.New("ino: missing checksum")
+	}
+
+	body, checksum := sentence[1:i], sentence[i+1:]
+	if expected := nmeaChecksum(body); !strings.EqualFold(expected, checksum) {
+		return PacketErrorChecksum, fmt.Errorf("ino: checksum '%v' doesn't match expected '%v'", checksum, expected)
+	}
+
+	tag, _, _ := strings.Cut(body, ",")
+	if tag != "AIVDM" && tag != "BSVDM" {
+		return PacketErrorUnsupported, fmt.Errorf("ino: unsupported sentence '%v'", tag)
+	}
+
+	if c := strings.Count(body, ","); c != 6 {
+		return PacketErrorMalformed, fmt.Errorf("ino: has %v fields instead of 7", c+1)
+	}
+
+	return "", nil
+}
+
+func (db *DB) AddPacketError(raw string, feedID int, reason string, cause error) error {
+	defer observeDBWrite("packet_error", time.Now())
+
+	stmt, err := db.prepared("insert into packet_error (raw, feed_id, reason, error) values ($1, $2, $3, $4)")
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(raw, feedID, reason, cause.Error())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (db *DB) GetPacketErrorsForFeed(feedID int, reason string, limit int) ([]*PacketError, error) {
+	packetErrors := []*PacketError{}
+	err := db.Select(&packetErrors, `
+		select
+			packet_error_id,
+			feed_id,
+			raw,
+			reason,
+			error,
+			created_at
+		from
+			packet_error
+		where
+			feed_id = $1
+			and ($2 = '' or reason = $2)
+		order by created_at desc
+		limit $3
+	`, feedID, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+	return packetErrors, nil
+}
+
+// GetPacketErrorStatsJSON reports, per feed, how many lines were received
+// over the window and how many of them were quarantined or failed to decode.
+// Lines that failed to decode, and fragments that were orphaned or expired,
+// were stored as packets too, so they aren't counted again.
+func (db *DB) GetPacketErrorStatsJSON(window time.Duration) ([]byte, error) {
+	var json []byte
+	err := db.QueryRow(`
+		with
+		packets as
+		(
+			select
+				feed_id,
+				count(1) packets
+			from
+				packet
+			where
+				created_at > now() - make_interval(secs => $1)
+			group by
+				feed_id
+		),
+		errors as
+		(
+			select
+				feed_id,
+				reason,
+				count(1) errors
+			from
+				packet_error
+			where
+				created_at > now() - make_interval(secs => $1)
+			group by
+				feed_id,
+				reason
+		),
+		stats as
+		(
+			select
+				f.feed_id "feedId",
+				f.remote_address "remoteAddress",
+				coalesce(p.packets, 0) + coalesce((select sum(e.errors) from errors e where e.feed_id = f.feed_id and e.reason not in ('decode', 'orphaned', 'expired')), 0) lines,
+				coalesce(p.packets, 0) packets,
+				coalesce((select sum(e.errors) from errors e where e.feed_id = f.feed_id), 0) errors,
+				coalesce((select json_object_agg(e.reason, e.errors) from errors e where e.feed_id = f.feed_id), '{}') reasons
+			from
+				feed f
+				left join packets p on p.feed_id = f.feed_id
+		)
+		select
+			coalesce(json_agg(s), '[]') json
+		from
+		(
+			select
+				stats.*,
+				case when lines = 0 then 0 else errors::double precision / lines end "errorRate"
+			from
+				stats
+			order by
+				"feedId"
+		) s
+	`, window.Seconds()).Scan(&json)
+	if err != nil {
+		return nil, err
+	}
+	return json, nil
+}
@@ -9,10 +9,11 @@ import (
 )
 
 type Position struct {
-	MMSI      int64      `json:"mmsi" db:"mmsi"`
-	Latitude  null.Float `json:"latitude" db:"latitude"`
-	Longitude null.Float `json:"longitude" db:"longitude"`
-	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	PositionID int64      `json:"positionId" db:"position_id"`
+	MMSI       int64      `json:"mmsi" db:"mmsi"`
+	Latitude   null.Float `json:"latitude" db:"latitude"`
+	Longitude  null.Float `json:"longitude" db:"longitude"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
 }
 
 func (db *DB) UpdatePosition(r nmeaais.DecoderOutput) {
@@ -21,18 +22,34 @@ func (db *DB) UpdatePosition(r nmeaais.DecoderOutput) {
 		if dm.Latitude == 91 || dm.Longitude == 181 {
 			break
 		}
+		start := time.Now()
 		err := db.UpdatePositionFromPositionReportClassA(dm)
+		observeDBWrite("position", start)
 		if err != nil {
 			slog.Error("Couldn't update position from PositionReportClassA", slog.Any("error", err))
+			break
 		}
+		db.observePosition(dm.MMSI, dm.Latitude, dm.Longitude, r.Timestamp)
 	case *nmeaais.PositionReportClassBStandard:
 		if dm.Latitude == 91 || dm.Longitude == 181 {
 			break
 		}
+		start := time.Now()
 		err := db.UpdatePositionFromPositionReportClassBStandard(dm)
+		observeDBWrite("position", start)
 		if err != nil {
 			slog.Error("Couldn't update vessel from PositionReportClassA", slog.Any("error", err))
+			break
 		}
+		db.observePosition(dm.MMSI, dm.Latitude, dm.Longitude, r.Timestamp)
 	default:
 	}
 }
+
+// observePosition hands a stored position to the zone tracker, as of when
+// it was received so late arrivals can be told apart.
+func (db *DB) observePosition(mmsi int64, lat float64, lon float64, at time.Time) {
+	if db.Zones != nil {
+		db.Zones.Observe(mmsi, lat, lon, at)
+	}
+}
@@ -0,0 +1,135 @@
+package ino
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type RateLimitOptions struct {
+	// Rate is how many requests a second each client can sustain.
+	Rate float64
+	// Burst is how many requests a client can make at once after being idle.
+	Burst int
+}
+
+// tokenBucket holds a client's remaining requests, refilled continuously at
+// the limiter's rate up to its burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps each client, an API key or otherwise an IP address, to
+// a steady request rate so one misbehaving client can't starve the rest.
+type RateLimiter struct {
+	options RateLimitOptions
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func NewRateLimiter(options *RateLimitOptions) *RateLimiter {
+	l := &RateLimiter{
+		options: *options,
+		buckets: map[string]*tokenBucket{},
+		swept:   time.Now(),
+	}
+	return l
+}
+
+// take spends a token from the client's bucket. When there isn't one it
+// returns how long until there will be.
+func (l *RateLimiter) take(client string, now time.Time) (bool, float64, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := float64(l.options.Burst)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.options.Rate)
+	b.last = now
+
+	l.sweep(now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.options.Rate * float64(time.Second))
+		return false, b.tokens, wait
+	}
+	b.tokens--
+	return true, b.tokens, 0
+}
+
+// sweep forgets clients whose buckets have refilled, since they're no
+// different from clients we've never seen. Callers hold mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	full := time.Duration(float64(l.options.Burst) / l.options.Rate * float64(time.Second))
+	if now.Sub(l.swept) < full {
+		return
+	}
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, client)
+		}
+	}
+	l.swept = now
+}
+
+// rateLimitClient is who a request counts against.
+func rateLimitClient(r *http.Request) string {
+	if key := RequestAPIKey(r.Context()); key != nil {
+		return "key:" + strconv.FormatInt(key.APIKeyID, 10)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Middleware rejects requests beyond a client's rate with 429 Too Many
+// Requests. It goes after authentication so keys get their own buckets.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.limit(w, r, rateLimitClient(r), next)
+	})
+}
+
+// limit spends one of the client's requests, passing the request on if it
+// had one left.
+func (l *RateLimiter) limit(w http.ResponseWriter, r *http.Request, client string, next http.Handler) {
+	ok, remaining, wait := l.take(client, time.Now())
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.options.Burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		httpError(w, r, &APIError{Status: http.StatusTooManyRequests, Err: fmt.Errorf("ino: rate limit exceeded, retry in %v", wait.Round(time.Millisecond))})
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// BeforeAuth limits requests carrying a key the Authenticator can't vouch
+// for from its cache, by IP address, before it looks the key up. Otherwise
+// a client could send endless made up keys, each costing a database query,
+// without ever reaching Middleware.
+func (l *RateLimiter) BeforeAuth(a *Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := requestToken(r)
+			if token == "" || a.known(token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			l.limit(w, r, rateLimitClient(r), next)
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package ino
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+)
+
+const (
+	// rollupBatch is how many receptions are rolled up per transaction, so
+	// catching up on history doesn't hold one open for long.
+	rollupBatch = 50000
+	// maxTimeseriesBuckets bounds how many points per group a series can
+	// have.
+	maxTimeseriesBuckets = 10000
+)
+
+// rollupIntervals are the bucket sizes receptions are counted over, with
+// how far back a series goes by default.
+var rollupIntervals = map[string]time.Duration{
+	"minute": 6 * time.Hour,
+	"hour":   7 * 24 * time.Hour,
+	"day":    90 * 24 * time.Hour,
+}
+
+// rollupDimensions are the groupBy values and the rollup columns they
+// group by.
+var rollupDimensions = map[string]string{
+	"type":  "type",
+	"feed":  "feed_id",
+	"class": "class",
+}
+
+type RollupOptions struct {
+	// MinuteRetention is how long per minute counts are kept. Hourly and
+	// daily counts are kept for good.
+	MinuteRetention time.Duration
+}
+
+// Rollup keeps message_rollup up to date, counting receptions per minute,
+// hour and day by message type, feed and class as they arrive. The counts
+// outlive archive purges, so traffic can be charted over any period without
+// touching the message tables.
+type Rollup struct {
+	DB      *DB
+	options RollupOptions
+	job     *periodicJob
+}
+
+func NewRollup(db *DB, options *RollupOptions) *Rollup {
+	r := &Rollup{
+		DB:      db,
+		options: *options,
+		job:     newPeriodicJob(),
+	}
+	return r
+}
+
+// Start rolls up new receptions every interval until Shutdown is called.
+func (r *Rollup) Start(interval time.Duration) {
+	r.job.start(interval, "Couldn't roll up messages", r.Run)
+}
+
+func (r *Rollup) Shutdown() {
+	r.job.stop()
+}
+
+// Run rolls up every reception that's settled, a batch at a time, then
+// drops minute counts past their retention.
+func (r *Rollup) Run() error {
+	total := int64(0)
+	for {
+		n, err := r.DB.RollupMessages(rollupBatch, settleLag)
+		if err != nil {
+			return err
+		}
+		total += n
+		if n == 0 {
+			break
+		}
+		if r.job.stopping() {
+			return nil
+		}
+	}
+	if total > 0 {
+		slog.Debug("Rolled up receptions", "count", total)
+	}
+
+	if r.options.MinuteRetention > 0 {
+		return r.DB.PruneMessageRollups("minute", time.Now().Add(-r.options.MinuteRetention))
+	}
+	return nil
+}
+
+// RollupMessages adds up to batch receptions past the last one rolled up
+// to the counts, returning how many it added. Receptions newer than lag
+// are left for next time.
+func (db *DB) RollupMessages(batch int, lag time.Duration) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var last int64
+	err = tx.QueryRow("select last_message_reception_id from message_rollup_state for update").Scan(&last)
+	if err != nil {
+		return 0, err
+	}
+
+	var next null.Int
+	var count int64
+	err = tx.QueryRow(`
+		select
+			max(message_reception_id),
+			count(1)
+		from
+		(
+			select
+				message_reception_id
+			from
+				message_reception
+			where
+				message_reception_id > $1
+				and created_at < now() - make_interval(secs => $3)
+			order by
+				message_reception_id
+			limit $2
+		) r
+	`, last, batch, lag.Seconds()).Scan(&next, &count)
+	if err != nil {
+		return 0, err
+	}
+	if !next.Valid {
+		return 0, nil
+	}
+
+	// A reception is counted as a message when it's the one the message was
+	// stored with, rather than another feed hearing it again.
+	_, err = tx.Exec(`
+		insert into message_rollup
+		(resolution, bucket, type, feed_id, class, receptions, messages)
+		select
+			i.resolution,
+			date_trunc(i.resolution, r.created_at, 'UTC') bucket,
+			m.type,
+			r.feed_id,
+			case when m.type in (18, 19, 24) then 'B' else 'A' end class,
+			count(1),
+			count(1) filter (where r.feed_id = m.feed_id and r.created_at = m.created_at)
+		from
+			message_reception r
+			join message m on m.message_id = r.message_id
+			cross join (values ('minute'), ('hour'), ('day')) i (resolution)
+		where
+			r.message_reception_id > $1
+			and r.message_reception_id <= $2
+		group by
+			1, 2, 3, 4, 5
+		on conflict (resolution, bucket, type, feed_id, class) do update
+		set
+			receptions = message_rollup.receptions + excluded.receptions,
+			messages = message_rollup.messages + excluded.messages
+	`, last, next)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("update message_rollup_state set last_message_reception_id = $1, updated_at = now()", next)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+func (db *DB) PruneMessageRollups(resolution string, before time.Time) error {
+	_, err := db.Exec("delete from message_rollup where resolution = $1 and bucket < $2", resolution, before)
+	return err
+}
+
+// TimeseriesPoint is the count for one bucket of one group. The dimensions
+// that weren't grouped by are null.
+type TimeseriesPoint struct {
+	Time   time.Time   `json:"time" db:"bucket"`
+	Type   null.Int    `json:"type" db:"type"`
+	FeedID null.Int    `json:"feedId" db:"feed_id"`
+	Class  null.String `json:"class" db:"class"`
+	// Receptions counts every feed that heard a message, so a message heard
+	// by two feeds counts twice. Messages counts it once.
+	Receptions int64 `json:"receptions" db:"receptions"`
+	Messages   int64 `json:"messages" db:"messages"`
+}
+
+type TimeseriesFilter struct {
+	Interval string
+	From     time.Time
+	To       time.Time
+	GroupBy  []string
+}
+
+// ParseTimeseriesFilter reads a TimeseriesFilter from query parameters:
+//
+//	interval=minute|hour|day, default hour
+//	from=<RFC 3339>&to=<RFC 3339>, default the interval's span up to now
+//	groupBy=type,feed,class
+func ParseTimeseriesFilter(q url.Values) (*TimeseriesFilter, error) {
+	f := &TimeseriesFilter{
+		Interval: "hour",
+		To:       time.Now(),
+	}
+
+	if v := q.Get("interval"); v != "" {
+		if _, ok := rollupIntervals[v]; !ok {
+			return nil, badRequestf("ino: invalid interval '%v', must be minute, hour or day", v)
+		}
+		f.Interval = v
+	}
+
+	for name, target := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, badRequestf("ino: invalid %v time '%v'", name, v)
+			}
+			*target = t
+		}
+	}
+	if f.From.IsZero() {
+		f.From = f.To.Add(-rollupIntervals[f.Interval])
+	}
+	if !f.From.Before(f.To) {
+		return nil, badRequestf("ino: from has to be before to")
+	}
+
+	size := map[string]time.Duration{"minute": time.Minute, "hour": time.Hour, "day": 24 * time.Hour}[f.Interval]
+	if f.To.Sub(f.From)/size > maxTimeseriesBuckets {
+		return nil, badRequestf("ino: too many %vs between from and to, at most %v", f.Interval, maxTimeseriesBuckets)
+	}
+
+	seen := map[string]bool{}
+	for _, v := range q["groupBy"] {
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if _, ok := rollupDimensions[p]; !ok {
+				return nil, badRequestf("ino: invalid groupBy '%v', must be type, feed or class", p)
+			}
+			if !seen[p] {
+				seen[p] = true
+				f.GroupBy = append(f.GroupBy, p)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// GetTimeseries sums the rollups into a series per group. Buckets where a
+// group had nothing are filled in with zeros so gaps in traffic stand out.
+func (db *DB) GetTimeseries(f *TimeseriesFilter) ([]*TimeseriesPoint, error) {
+	selected := map[string]string{
+		"type":    "null::integer type",
+		"feed_id": "null::integer feed_id",
+		"class":   "null::character varying class",
+	}
+	var columns, joins []string
+	for _, d := range f.GroupBy {
+		column := rollupDimensions[d]
+		columns = append(columns, column)
+		joins = append(joins, "r."+column+" = g."+column)
+		selected[column] = "g." + column
+	}
+
+	groups := "select 1"
+	grouped := "bucket"
+	if len(columns) > 0 {
+		groups = "select distinct " + strings.Join(columns, ", ") + " from rolled"
+		grouped = "bucket, " + strings.Join(columns, ", ")
+	}
+	on := strings.Join(append([]string{"r.bucket = b.bucket"}, joins...), " and ")
+	order := strings.Join(append([]string{"b.bucket"}, columns...), ", ")
+
+	points := []*TimeseriesPoint{}
+	err := db.Select(&points, `
+		with
+		buckets as
+		(
+			select
+				generate_series(
+					date_trunc($1, $2::timestamptz, 'UTC'),
+					$3::timestamptz,
+					('1 ' || $1)::interval,
+					'UTC'
+				) bucket
+		),
+		rolled as
+		(
+			select
+				`+grouped+`,
+				sum(receptions) receptions,
+				sum(messages) messages
+			from
+				message_rollup
+			where
+				resolution = $1
+				and bucket >= date_trunc($1, $2::timestamptz, 'UTC')
+				and bucket <= $3
+			group by
+				`+grouped+`
+		),
+		groups as
+		(
+			`+groups+`
+		)
+		select
+			b.bucket,
+			`+selected["type"]+`,
+			`+selected["feed_id"]+`,
+			`+selected["class"]+`,
+			coalesce(r.receptions, 0) receptions,
+			coalesce(r.messages, 0) messages
+		from
+			buckets b
+			cross join groups g
+			left join rolled r on `+on+`
+		order by
+			`+order+`
+	`, f.Interval, f.From, f.To)
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (s *HTTPServer) GetTimeseries(w http.ResponseWriter, r *http.Request) error {
+	filter, err := ParseTimeseriesFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	points, err := s.DB.GetTimeseries(filter)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, points)
+	return nil
+}
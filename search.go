@@ -0,0 +1,101 @@
+package ino
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
+
+// SearchResult is a vessel matching a search along with how closely it
+// matched, from 0 to 1.
+type SearchResult struct {
+	Vessel
+	Score float64 `json:"score" db:"score"`
+}
+
+// SearchVessels finds vessels whose name, call sign or destination are
+// similar to q, or whose MMSI or IMO number start with it. Matches are
+// ranked by how recently the vessel was heard from.
+func (db *DB) SearchVessels(q string, limit int) ([]*SearchResult, error) {
+	results := []*SearchResult{}
+	err := db.Select(&results, `
+		select
+			mmsi,
+			vessel_name,
+			call_sign,
+			ship_type,
+			length,
+			breadth,
+			draught,
+			latitude,
+			longitude,
+			speed_over_ground,
+			true_heading,
+			course_over_ground,
+			navigation_status,
+			destination,
+			imo_number,
+			class,
+			feed_id,
+			updated_at,
+			greatest(
+				case when mmsi::text like $2 || '%' or imo_number::text like $2 || '%' then 1 end,
+				similarity(vessel_name, $1),
+				similarity(call_sign, $1),
+				similarity(destination, $1)
+			) score
+		from
+			vessel
+		where
+			vessel_name % $1
+			or call_sign % $1
+			or destination % $1
+			or vessel_name ilike '%' || $2 || '%'
+			or call_sign ilike $2 || '%'
+			or mmsi::text like $2 || '%'
+			or imo_number::text like $2 || '%'
+		order by
+			updated_at desc
+		limit $3
+	`, q, escapeLike(q), limit)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// escapeLike keeps user input from being read as like wildcards.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *HTTPServer) SearchVessels(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		return badRequestf("ino: search needs a q parameter")
+	}
+
+	limit := defaultSearchLimit
+	if v := query.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			return badRequestf("ino: invalid limit '%v', must be between 1 and %v", v, maxSearchLimit)
+		}
+	}
+
+	results, err := s.DB.SearchVessels(q, limit)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, results)
+	return nil
+}
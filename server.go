@@ -2,58 +2,160 @@ package ino
 
 import (
 	"encoding/json"
-	"log/slog"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func CreateRouter(server *HTTPServer) (*chi.Mux, error) {
 	r := chi.NewRouter()
 
+	r.Use(middleware.RequestID)
+	if server.TrustProxy {
+		r.Use(middleware.RealIP)
+	}
+	r.Use(middleware.Compress(5, compressibleTypes...))
+	r.Use(accessLog)
+	allowedOrigins := server.AllowedOrigins
+	if len(allowedOrigins) == 0 {
+		allowedOrigins = []string{"https://*", "http://*"}
+	}
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "If-None-Match", "X-API-Key", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"ETag", "Link", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-Request-Id"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
 
+	// Health checks are for orchestrators and load balancers, which don't
+	// carry API keys and shouldn't be rate limited.
+	r.Method(http.MethodGet, "/healthz", makeHTTPHandler(http.MethodGet, "/healthz", server.Healthz))
+	r.Method(http.MethodGet, "/readyz", makeHTTPHandler(http.MethodGet, "/readyz", server.Readyz))
+
+	var protected []func(http.Handler) http.Handler
+	if server.Auth != nil {
+		if server.RateLimit != nil {
+			protected = append(protected, server.RateLimit.BeforeAuth(server.Auth))
+		}
+		protected = append(protected, server.Auth.Middleware)
+	}
+	if server.RateLimit != nil {
+		protected = append(protected, server.RateLimit.Middleware)
+	}
+	api := r.With(protected...)
+
 	m := map[string]map[string]HTTPApiFunc{
 		"GET": {
-			"/api/vessels":                             server.GetVessels,
-			"/api/vessels/{mmsi:[0-9]+}":               server.GetVesselByMmsi,
-			"/api/vessels/{mmsi:[0-9]+}/positions":     server.GetPositionsForVessel,
-			"/api/stats/message":                       server.GetMessageStats,
-			"/api/stats/message/vessels":               server.GetMessageStatsByVessel,
-			"/api/stats/message/{type:[0-9]+}/vessels": server.GetMessageStatsByVesselForType,
-			"/api/stats/message/vessels/{mmsi:[0-9]+}": server.GetMessageStatsByVesselForVessel,
+			"/api/vessels":                                            server.cached(vesselsCacheTTL, server.GetVessels),
+			"/api/vessels/{mmsi:[0-9]+}":                              server.GetVesselByMmsi,
+			"/api/vessels/near":                                       server.GetVesselsNear,
+			"/api/vessels/{mmsi:[0-9]+}/neighbors":                    server.GetVesselNeighbors,
+			"/api/vessels/{mmsi:[0-9]+}/messages":                     server.GetMessagesForVessel,
+			"/api/vessels/{mmsi:[0-9]+}/positions":                    server.GetPositionsForVessel,
+			"/api/vessels/{mmsi:[0-9]+}/voyages":                      server.GetVoyagesForVessel,
+			"/api/openapi.json":                                       server.GetOpenAPI,
+			"/api/search":                                             server.SearchVessels,
+			"/api/stats/message":                                      server.cached(statsCacheTTL, server.GetMessageStats),
+			"/api/stats/message/vessels":                              server.cached(statsCacheTTL, server.GetMessageStatsByVessel),
+			"/api/stats/message/{type:[0-9]+}/vessels":                server.cached(statsCacheTTL, server.GetMessageStatsByVesselForType),
+			"/api/stats/message/vessels/{mmsi:[0-9]+}":                server.cached(statsCacheTTL, server.GetMessageStatsByVesselForVessel),
+			"/api/stats/errors":                                       server.cached(statsCacheTTL, server.GetPacketErrorStats),
+			"/api/stats/feeds":                                        server.cached(statsCacheTTL, server.GetFeedStats),
+			"/api/stats/feeds/messages":                               server.cached(statsCacheTTL, server.GetFeedMessageRate),
+			"/api/stats/feeds/vessels":                                server.cached(statsCacheTTL, server.GetFeedVesselRate),
+			"/api/stats/feeds/{id:[0-9]+}/exclusive":                  server.cached(statsCacheTTL, server.GetExclusiveVessels),
+			"/api/stats/timeseries":                                   server.cached(statsCacheTTL, server.GetTimeseries),
+			"/api/stats/fragments":                                    server.GetFragmentStats,
+			"/api/stream":                                             server.Stream,
+			"/api/stream/sse":                                         server.StreamSSE,
+			"/api/stream/ws":                                          server.StreamWebSocket,
+			"/api/tiles/vessels/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.mvt": server.GetVesselTile,
+			"/api/tiles/tracks/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}.mvt":  server.GetTrackTile,
+			"/api/feeds":                                              server.GetFeeds,
+			"/api/feeds/status":                                       server.GetFeedStatus,
+			"/api/feeds/{id:[0-9]+}":                                  server.GetFeed,
+			"/api/feeds/{id:[0-9]+}/messages":                         server.GetMessagesForFeed,
+			"/api/feeds/{id:[0-9]+}/errors":                           server.GetPacketErrorsForFeed,
+			"/api/feeds/{id:[0-9]+}/coverage":                         server.cached(statsCacheTTL, server.GetFeedCoverage),
+			"/api/zones":                                              server.GetZones,
+			"/api/zones/{id:[0-9]+}":                                  server.GetZone,
+			"/api/zones/{id:[0-9]+}/occupancy":                        server.GetZoneOccupancy,
+			"/api/zones/{id:[0-9]+}/events":                           server.GetZoneEvents,
+			"/api/ports/{id:[0-9]+}/calls":                            server.GetPortCalls,
+			"/api/alerts/rules":                                       server.GetAlertRules,
+			"/api/alerts/rules/{id:[0-9]+}":                           server.GetAlertRule,
+			"/api/alerts/rules/{id:[0-9]+}/deliveries":                server.GetAlertDeliveries,
+		},
+		"POST": {
+			"/api/feeds":                         server.CreateFeed,
+			"/api/zones":                         server.CreateZone,
+			"/api/alerts/rules":                  server.CreateAlertRule,
+			"/api/alerts/rules/{id:[0-9]+}/test": server.TestAlertRule,
+		},
+		"PUT": {
+			"/api/feeds/{id:[0-9]+}":        server.UpdateFeed,
+			"/api/zones/{id:[0-9]+}":        server.UpdateZone,
+			"/api/alerts/rules/{id:[0-9]+}": server.UpdateAlertRule,
+		},
+		"DELETE": {
+			"/api/feeds/{id:[0-9]+}":        server.DeleteFeed,
+			"/api/zones/{id:[0-9]+}":        server.DeleteZone,
+			"/api/alerts/rules/{id:[0-9]+}": server.DeleteAlertRule,
 		},
-		"PUT": {},
 		"OPTIONS": {
 			"/": options,
 		},
 	}
 
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		httpError(w, r, notFoundf("ino: no route for %v", r.URL.Path))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		httpError(w, r, &APIError{Status: http.StatusMethodNotAllowed, Err: fmt.Errorf("ino: %v isn't allowed on %v", r.Method, r.URL.Path)})
+	})
+
+	spec, err := LoadOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.checkRoutes(m); err != nil {
+		return nil, err
+	}
+
 	for method, routes := range m {
 		for route, handler := range routes {
 			localRoute := route
 			localHandler := handler
 			localMethod := method
 			f := makeHTTPHandler(localMethod, localRoute, localHandler)
-			r.Method(localMethod, localRoute, f)
+			api.Method(localMethod, localRoute, f)
 		}
 	}
+
+	// Metrics live outside the API and its spec, where scrapers expect them,
+	// and like the health checks don't need a key or count against a rate.
+	r.Method(http.MethodGet, "/metrics", promhttp.Handler())
 	return r, nil
 }
 
-func makeHTTPHandler(_ string, _ string, handlerFunc HTTPApiFunc) http.HandlerFunc {
+func makeHTTPHandler(method string, _ string, handlerFunc HTTPApiFunc) http.HandlerFunc {
+	role := requiredRole(method)
 	return func(w http.ResponseWriter, r *http.Request) {
+		if err := authorize(r, role); err != nil {
+			httpError(w, r, err)
+			return
+		}
 		if err := handlerFunc(w, r); err != nil {
-			httpError(w, err)
+			httpError(w, r, err)
 		}
 	}
 }
@@ -61,12 +163,36 @@ func makeHTTPHandler(_ string, _ string, handlerFunc HTTPApiFunc) http.HandlerFu
 type HTTPApiFunc func(w http.ResponseWriter, r *http.Request) error
 
 type HTTPServer struct {
-	DB *DB
+	DB    *DB
+	Feeds *MonstahManager
+	// Auth checks API keys. Without it every request is anonymous, so only
+	// read routes can be used.
+	Auth *Authenticator
+	// AllowedOrigins are the CORS origins, any origin when empty.
+	AllowedOrigins []string
+	// Cache holds the responses of the expensive routes for a few seconds.
+	// Without it every request goes to the database.
+	Cache *ResponseCache
+	// RateLimit limits how fast each client can make requests.
+	RateLimit *RateLimiter
+	// TrustProxy takes the client's address from X-Forwarded-For or
+	// X-Real-IP, for running behind a reverse proxy.
+	TrustProxy bool
+	// Coverage is what keeps feed coverage maps up to date. Without it
+	// there are no coverage maps.
+	Coverage *CoverageMapper
+	// Zones tracks vessels in and out of zones, for occupancy.
+	Zones *ZoneTracker
+	// Alerts sends webhooks for alert rules, and test deliveries.
+	Alerts *AlertEngine
+	// Health sets what /readyz expects.
+	Health HealthOptions
 }
 
-func NewHTTPServer(db *DB) *HTTPServer {
+func NewHTTPServer(db *DB, feeds *MonstahManager) *HTTPServer {
 	s := &HTTPServer{
-		DB: db,
+		DB:    db,
+		Feeds: feeds,
 	}
 
 	return s
@@ -92,13 +218,35 @@ func writeJSONDirect(w http.ResponseWriter, code int, thing []byte) {
 	w.Write(thing)
 }
 
-func httpError(w http.ResponseWriter, err error) {
-	statusCode := http.StatusInternalServerError
+// writeNextLink points the client at the next page of results by repeating
+// the request with its cursor swapped for the given one.
+func writeNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	next := *r.URL
+	q := next.Query()
+	q.Set("cursor", cursor)
+	next.RawQuery = q.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
 
+// urlParamInt reads an integer path parameter. The routes only match digits,
+// so this only fails when the number is too big, which is still the client's
+// problem.
+func urlParamInt(r *http.Request, name string) (int, error) {
+	v := chi.URLParam(r, name)
+	i, err := strconv.Atoi(v)
 	if err != nil {
-		slog.Error("http error", slog.Any("error", err))
-		http.Error(w, err.Error(), statusCode)
+		return 0, badRequestf("ino: invalid %v '%v'", name, v)
 	}
+	return i, nil
+}
+
+func urlParamInt64(r *http.Request, name string) (int64, error) {
+	v := chi.URLParam(r, name)
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, badRequestf("ino: invalid %v '%v'", name, v)
+	}
+	return i, nil
 }
 
 func options(w http.ResponseWriter, r *http.Request) error {
@@ -107,22 +255,39 @@ func options(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (s *HTTPServer) GetVessels(w http.ResponseWriter, r *http.Request) error {
-	query := r.URL.Query()
-	format := query.Get("f")
+	format, err := responseFormat(r)
+	if err != nil {
+		return err
+	}
+
+	filter, err := ParseVesselFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
 
-	if format == "geojson" {
-		geojson, err := s.DB.GetVesselsGeojson()
+	if format == FormatGeoJSON {
+		geojson, err := s.DB.GetVesselsGeojson(filter)
 		if err != nil {
 			return err
 		}
 
 		writeGeoJSON(w, http.StatusOK, geojson)
-	} else {
-		vessels, err := s.DB.GetVessels()
-		if err != nil {
-			return err
-		}
+		return nil
+	}
 
+	vessels, err := s.DB.GetVessels(filter)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatKML:
+		return writeExport(w, format, "vessels", func(out io.Writer) error { return renderVesselsKML(out, vessels) })
+	case FormatGPX:
+		return writeExport(w, format, "vessels", func(out io.Writer) error { return renderVesselsGPX(out, vessels) })
+	case FormatCSV:
+		return writeExport(w, format, "vessels", func(out io.Writer) error { return renderVesselsCSV(out, vessels) })
+	default:
 		writeJSON(w, http.StatusOK, vessels)
 	}
 
@@ -130,7 +295,7 @@ func (s *HTTPServer) GetVessels(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (s *HTTPServer) GetVesselByMmsi(w http.ResponseWriter, r *http.Request) error {
-	mmsi, err := strconv.Atoi(chi.URLParam(r, "mmsi"))
+	mmsi, err := urlParamInt(r, "mmsi")
 	if err != nil {
 		return err
 	}
@@ -145,27 +310,57 @@ func (s *HTTPServer) GetVesselByMmsi(w http.ResponseWriter, r *http.Request) err
 }
 
 func (s *HTTPServer) GetPositionsForVessel(w http.ResponseWriter, r *http.Request) error {
-	mmsi, err := strconv.Atoi(chi.URLParam(r, "mmsi"))
+	mmsi, err := urlParamInt(r, "mmsi")
 	if err != nil {
 		return err
 	}
 
-	query := r.URL.Query()
-	format := query.Get("f")
+	format, err := responseFormat(r)
+	if err != nil {
+		return err
+	}
+
+	filter, err := ParseTrackFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
 
-	if format == "geojson" {
-		geojson, err := s.DB.GetPositionsForVesselGeojson(mmsi)
+	if _, err := s.DB.GetVessel(mmsi); err != nil {
+		return err
+	}
+
+	if format == FormatGeoJSON {
+		geojson, err := s.DB.GetPositionsForVesselGeojson(mmsi, filter)
 		if err != nil {
 			return err
 		}
 
 		writeGeoJSON(w, http.StatusOK, geojson)
-	} else {
-		positions, err := s.DB.GetPositionsForVessel(mmsi)
-		if err != nil {
-			return err
-		}
+		return nil
+	}
+
+	positions, err := s.DB.GetPositionsForVessel(mmsi, filter)
+	if err != nil {
+		return err
+	}
 
+	if filter.Limit > 0 && len(positions) == filter.Limit {
+		last := positions[len(positions)-1]
+		cursor := &TrackCursor{CreatedAt: last.CreatedAt, PositionID: last.PositionID}
+		writeNextLink(w, r, cursor.String())
+	}
+
+	filename := strconv.Itoa(mmsi)
+	switch format {
+	case FormatKML:
+		segments := trackSegments(positions, filter)
+		return writeExport(w, format, filename, func(out io.Writer) error { return renderTrackKML(out, mmsi, segments) })
+	case FormatGPX:
+		segments := trackSegments(positions, filter)
+		return writeExport(w, format, filename, func(out io.Writer) error { return renderTrackGPX(out, mmsi, segments) })
+	case FormatCSV:
+		return writeExport(w, format, filename, func(out io.Writer) error { return renderPositionsCSV(out, positions) })
+	default:
 		writeJSON(w, http.StatusOK, positions)
 	}
 
@@ -191,7 +386,7 @@ func (s *HTTPServer) GetMessageStatsByVessel(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *HTTPServer) GetMessageStatsByVesselForType(w http.ResponseWriter, r *http.Request) error {
-	messageType, err := strconv.Atoi(chi.URLParam(r, "type"))
+	messageType, err := urlParamInt(r, "type")
 	if err != nil {
 		return err
 	}
@@ -205,7 +400,7 @@ func (s *HTTPServer) GetMessageStatsByVesselForType(w http.ResponseWriter, r *ht
 }
 
 func (s *HTTPServer) GetMessageStatsByVesselForVessel(w http.ResponseWriter, r *http.Request) error {
-	mmsi, err := strconv.Atoi(chi.URLParam(r, "mmsi"))
+	mmsi, err := urlParamInt(r, "mmsi")
 	if err != nil {
 		return err
 	}
@@ -217,3 +412,54 @@ func (s *HTTPServer) GetMessageStatsByVesselForVessel(w http.ResponseWriter, r *
 	writeJSONDirect(w, http.StatusOK, json)
 	return nil
 }
+
+func (s *HTTPServer) GetPacketErrorsForFeed(w http.ResponseWriter, r *http.Request) error {
+	feedID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetFeed(feedID); err != nil {
+		return err
+	}
+
+	query := r.URL.Query()
+	limit := defaultPacketErrorLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPacketErrorLimit {
+			return badRequestf("ino: invalid limit '%v', must be between 1 and %v", l, maxPacketErrorLimit)
+		}
+	}
+
+	packetErrors, err := s.DB.GetPacketErrorsForFeed(feedID, query.Get("reason"), limit)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, packetErrors)
+	return nil
+}
+
+func (s *HTTPServer) GetPacketErrorStats(w http.ResponseWriter, r *http.Request) error {
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		var err error
+		window, err = time.ParseDuration(v)
+		if err != nil {
+			return badRequestf("ino: invalid window '%v'", v)
+		}
+	}
+
+	json, err := s.DB.GetPacketErrorStatsJSON(window)
+	if err != nil {
+		return err
+	}
+	writeJSONDirect(w, http.StatusOK, json)
+	return nil
+}
+
+func (s *HTTPServer) GetFragmentStats(w http.ResponseWriter, r *http.Request) error {
+	writeJSON(w, http.StatusOK, s.Feeds.FragmentStats())
+	return nil
+}
@@ -0,0 +1,125 @@
+package ino
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	streamKeepalive    = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// Stream serves WebSocket clients over WebSocket and everyone else over SSE.
+func (s *HTTPServer) Stream(w http.ResponseWriter, r *http.Request) error {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return s.StreamWebSocket(w, r)
+	}
+	return s.StreamSSE(w, r)
+}
+
+// StreamSSE pushes vessel updates to the client as Server-Sent Events until
+// it disconnects or falls too far behind.
+func (s *HTTPServer) StreamSSE(w http.ResponseWriter, r *http.Request) error {
+	filter, err := ParseStreamFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("ino: response doesn't support streaming")
+	}
+
+	sub := s.Feeds.Hub.Subscribe(filter)
+	defer s.Feeds.Hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(streamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case b, ok := <-sub.Updates:
+			if !ok {
+				fmt.Fprint(w, "event: dropped\ndata: {\"reason\":\"slow consumer\"}\n\n")
+				flusher.Flush()
+				return nil
+			}
+			fmt.Fprintf(w, "event: vessel\ndata: %s\n\n", b)
+		}
+		flusher.Flush()
+	}
+}
+
+// StreamWebSocket pushes vessel updates to the client as WebSocket text
+// messages until it disconnects or falls too far behind.
+func (s *HTTPServer) StreamWebSocket(w http.ResponseWriter, r *http.Request) error {
+	filter, err := ParseStreamFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		OriginPatterns: websocketOriginPatterns(s.AllowedOrigins),
+	})
+	if err != nil {
+		// Accept has already written the failure to the client.
+		slog.Error("Couldn't accept websocket", slog.Any("error", err))
+		return nil
+	}
+	defer c.CloseNow()
+
+	ctx := c.CloseRead(r.Context())
+
+	sub := s.Feeds.Hub.Subscribe(filter)
+	defer s.Feeds.Hub.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case b, ok := <-sub.Updates:
+			if !ok {
+				c.Close(websocket.StatusPolicyViolation, "slow consumer")
+				return nil
+			}
+			wctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := c.Write(wctx, websocket.MessageText, b)
+			cancel()
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// websocketOriginPatterns turns the CORS origins into the host patterns
+// WebSocket origins are checked against. Without any, only pages served from
+// the same host can connect.
+func websocketOriginPatterns(origins []string) []string {
+	var patterns []string
+	for _, origin := range origins {
+		if _, host, ok := strings.Cut(origin, "://"); ok {
+			origin = host
+		}
+		patterns = append(patterns, origin)
+	}
+	return patterns
+}
@@ -0,0 +1,23 @@
+package ino
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWebsocketOriginPatterns(t *testing.T) {
+	cases := []struct {
+		origins []string
+		want    []string
+	}{
+		{nil, nil},
+		{[]string{"https://example.com"}, []string{"example.com"}},
+		{[]string{"https://*.example.com", "http://localhost:3000"}, []string{"*.example.com", "localhost:3000"}},
+		{[]string{"*"}, []string{"*"}},
+	}
+	for _, c := range cases {
+		if got := websocketOriginPatterns(c.origins); !slices.Equal(got, c.want) {
+			t.Errorf("websocketOriginPatterns(%q) = %q, want %q", c.origins, got, c.want)
+		}
+	}
+}
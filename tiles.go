@@ -0,0 +1,198 @@
+package ino
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// vesselTileMaxAge is short since vessels move, track tiles change more
+	// slowly relative to what they show.
+	vesselTileMaxAge = 30 * time.Second
+	trackTileMaxAge  = 5 * time.Minute
+	// defaultTrackTileWindow is how much history track tiles show unless the
+	// client asks for something else with hours=.
+	defaultTrackTileWindow = 24 * time.Hour
+	maxTileZoom            = 22
+)
+
+// GetVesselTile renders the vessels inside a web mercator tile as a Mapbox
+// Vector Tile. Attributes are thinned out at low zooms where there are too
+// many vessels for labels to be useful anyway.
+//
+// Vessels are matched against the tile in web mercator rather than as
+// geography, where the tile's edges would be great circles and the world
+// tiles' edges at ±180° would collapse.
+func (db *DB) GetVesselTile(z, x, y int) ([]byte, error) {
+	var tile []byte
+	err := db.QueryRow(`
+		with
+		bounds as
+		(
+			select ST_TileEnvelope($1, $2, $3) the_geom
+		),
+		features as
+		(
+			select
+				ST_AsMVTGeom(ST_Transform(v.the_geog::geometry, 3857), bounds.the_geom) the_geom,
+				v.mmsi,
+				v.class,
+				v.course_over_ground,
+				v.true_heading,
+				case when $1 >= 8 then v.ship_type end ship_type,
+				case when $1 >= 8 then v.speed_over_ground end speed_over_ground,
+				case when $1 >= 8 then v.navigation_status end navigation_status,
+				case when $1 >= 11 then v.vessel_name end vessel_name,
+				case when $1 >= 11 then v.call_sign end call_sign,
+				case when $1 >= 11 then v.destination end destination,
+				case when $1 >= 11 then v.length end length,
+				case when $1 >= 11 then v.breadth end breadth,
+				case when $1 >= 11 then v.updated_at::text end updated_at
+			from
+				vessel v,
+				bounds
+			where
+				ST_Y(v.the_geog::geometry) between -85.0511 and 85.0511
+				and ST_Transform(v.the_geog::geometry, 3857) && bounds.the_geom
+		)
+		select
+			ST_AsMVT(features.*, 'vessels', 4096, 'the_geom')
+		from
+			features
+	`, z, x, y).Scan(&tile)
+	if err != nil {
+		return nil, err
+	}
+	return tile, nil
+}
+
+// GetTrackTile renders the recent tracks of vessels passing through a web
+// mercator tile as a Mapbox Vector Tile.
+func (db *DB) GetTrackTile(z, x, y int, window time.Duration) ([]byte, error) {
+	var tile []byte
+	err := db.QueryRow(`
+		with
+		bounds as
+		(
+			select
+				ST_TileEnvelope($1, $2, $3) the_geom,
+				ST_TileEnvelope($1, $2, $3, margin => 0.125) the_buffered_geom
+		),
+		tracks as
+		(
+			select
+				p.mmsi,
+				st_makeline(ST_Transform(p.the_geog::geometry, 3857) order by p.created_at) the_geom,
+				min(p.created_at) started_at,
+				max(p.created_at) ended_at
+			from
+				position p,
+				bounds
+			where
+				p.created_at > now() - make_interval(secs => $4)
+				and ST_Y(p.the_geog::geometry) between -85.0511 and 85.0511
+				and ST_Transform(p.the_geog::geometry, 3857) && bounds.the_buffered_geom
+			group by
+				p.mmsi
+			having
+				count(1) > 1
+		),
+		features as
+		(
+			select
+				ST_AsMVTGeom(t.the_geom, bounds.the_geom) the_geom,
+				t.mmsi,
+				case when $1 >= 8 then t.started_at::text end started_at,
+				case when $1 >= 8 then t.ended_at::text end ended_at
+			from
+				tracks t,
+				bounds
+		)
+		select
+			ST_AsMVT(features.*, 'tracks', 4096, 'the_geom')
+		from
+			features
+		where
+			the_geom is not null
+	`, z, x, y, window.Seconds()).Scan(&tile)
+	if err != nil {
+		return nil, err
+	}
+	return tile, nil
+}
+
+func (s *HTTPServer) GetVesselTile(w http.ResponseWriter, r *http.Request) error {
+	z, x, y, err := tileCoordinates(r)
+	if err != nil {
+		return err
+	}
+
+	tile, err := s.DB.GetVesselTile(z, x, y)
+	if err != nil {
+		return err
+	}
+
+	writeTile(w, tile, vesselTileMaxAge)
+	return nil
+}
+
+func (s *HTTPServer) GetTrackTile(w http.ResponseWriter, r *http.Request) error {
+	z, x, y, err := tileCoordinates(r)
+	if err != nil {
+		return err
+	}
+
+	window := defaultTrackTileWindow
+	if v := r.URL.Query().Get("hours"); v != "" {
+		hours, err := strconv.ParseFloat(v, 64)
+		if err != nil || hours <= 0 {
+			return badRequestf("ino: invalid hours '%v'", v)
+		}
+		window = time.Duration(hours * float64(time.Hour))
+	}
+
+	tile, err := s.DB.GetTrackTile(z, x, y, window)
+	if err != nil {
+		return err
+	}
+
+	writeTile(w, tile, trackTileMaxAge)
+	return nil
+}
+
+func tileCoordinates(r *http.Request) (int, int, int, error) {
+	z, err := urlParamInt(r, "z")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	x, err := urlParamInt(r, "x")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	y, err := urlParamInt(r, "y")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if z > maxTileZoom {
+		return 0, 0, 0, badRequestf("ino: zoom %v is beyond the maximum of %v", z, maxTileZoom)
+	}
+	if n := 1 << z; x >= n || y >= n {
+		return 0, 0, 0, badRequestf("ino: tile is outside the zoom level's grid")
+	}
+
+	return z, x, y, nil
+}
+
+func writeTile(w http.ResponseWriter, tile []byte, maxAge time.Duration) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	if len(tile) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.WriteHeader(http.StatusOK)
+	w.Write(tile)
+}
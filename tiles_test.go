@@ -0,0 +1,44 @@
+package ino
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ralreegorganon/nmeaais"
+)
+
+func TestVesselTileWorld(t *testing.T) {
+	db := openTestDB(t)
+	t.Cleanup(func() { db.Exec("delete from vessel where mmsi = $1", benchMMSI) })
+
+	// Near the antimeridian and well north, where treating the world tile's
+	// edges as great circles lost vessels.
+	err := db.UpdateVesselFromPositionReportClassA(&nmeaais.PositionReportClassA{
+		MMSI:             benchMMSI,
+		NavigationStatus: "Under way using engine",
+		Latitude:         70,
+		Longitude:        179.9,
+	}, benchFeedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct{ z, x, y int }{{0, 0, 0}, {1, 1, 0}} {
+		tile, err := db.GetVesselTile(c.z, c.x, c.y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !mvtHasInt(tile, benchMMSI) {
+			t.Errorf("tile %v/%v/%v doesn't have vessel %v", c.z, c.x, c.y, benchMMSI)
+		}
+	}
+}
+
+// mvtHasInt reports whether a vector tile has an int_value of v among its
+// attribute values, which is how the mmsi is encoded.
+func mvtHasInt(tile []byte, v int64) bool {
+	// int_value is field 4 of Value, a varint.
+	value := binary.AppendUvarint([]byte{4<<3 | 0}, uint64(v))
+	return bytes.Contains(tile, value)
+}
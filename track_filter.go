@@ -0,0 +1,142 @@
+package ino
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+)
+
+// TrackFilter selects part of a vessel's position history.
+type TrackFilter struct {
+	From null.Time
+	To   null.Time
+	// Limit and Cursor page through the JSON positions newest first. A zero
+	// Limit returns everything.
+	Limit  int
+	Cursor *TrackCursor
+	// Simplify is the tolerance, in approximate meters, used to simplify
+	// GeoJSON tracks. Zero leaves them as is.
+	Simplify float64
+	// Gap and GapDistance split GeoJSON tracks into separate segments when
+	// consecutive positions are further apart in time or space. Zero
+	// disables either check.
+	Gap         time.Duration
+	GapDistance float64
+}
+
+// TrackCursor is the position a page of results ended on.
+type TrackCursor struct {
+	CreatedAt  time.Time
+	PositionID int64
+}
+
+const defaultTrackGap = 30 * time.Minute
+
+// ParseTrackFilter reads a TrackFilter from query parameters:
+//
+//	from=<RFC 3339>&to=<RFC 3339>
+//	limit=<count>&cursor=<cursor from the previous page's Link header>
+//	simplify=<meters>
+//	gap=<minutes, default 30>&gapDistance=<meters>
+func ParseTrackFilter(q url.Values) (*TrackFilter, error) {
+	f := &TrackFilter{
+		Gap: defaultTrackGap,
+	}
+
+	for name, target := range map[string]*null.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, badRequestf("ino: invalid %v time '%v'", name, v)
+			}
+			*target = null.TimeFrom(t)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, badRequestf("ino: invalid limit '%v'", v)
+		}
+		f.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := parseTrackCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		f.Cursor = c
+	}
+
+	if v := q.Get("simplify"); v != "" {
+		tolerance, err := strconv.ParseFloat(v, 64)
+		if err != nil || tolerance < 0 {
+			return nil, badRequestf("ino: invalid simplify tolerance '%v'", v)
+		}
+		f.Simplify = tolerance
+	}
+
+	if v := q.Get("gap"); v != "" {
+		minutes, err := strconv.ParseFloat(v, 64)
+		if err != nil || minutes < 0 {
+			return nil, badRequestf("ino: invalid gap minutes '%v'", v)
+		}
+		f.Gap = time.Duration(minutes * float64(time.Minute))
+	}
+
+	if v := q.Get("gapDistance"); v != "" {
+		meters, err := strconv.ParseFloat(v, 64)
+		if err != nil || meters < 0 {
+			return nil, badRequestf("ino: invalid gap distance '%v'", v)
+		}
+		f.GapDistance = meters
+	}
+
+	return f, nil
+}
+
+// String encodes the cursor as the opaque token handed back to clients.
+func (c *TrackCursor) String() string {
+	return encodeCursor(c.CreatedAt, c.PositionID)
+}
+
+func parseTrackCursor(s string) (*TrackCursor, error) {
+	t, id, err := decodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackCursor{CreatedAt: t, PositionID: id}, nil
+}
+
+// encodeCursor and decodeCursor handle the keyset cursors used to page
+// through rows ordered by creation time and then id.
+func encodeCursor(t time.Time, id int64) string {
+	raw := strconv.FormatInt(t.UnixMicro(), 10) + "," + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (time.Time, int64, error) {
+	invalid := badRequestf("ino: invalid cursor '%v'", s)
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	t, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return time.Time{}, 0, invalid
+	}
+	micros, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	rowID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	return time.UnixMicro(micros), rowID, nil
+}
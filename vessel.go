@@ -23,36 +23,79 @@ type Vessel struct {
 	CourseOverGround null.Float  `json:"courseOverGround" db:"course_over_ground"`
 	NavigationStatus null.String `json:"navigationStatus" db:"navigation_status"`
 	Destination      null.String `json:"destination" db:"destination"`
+	IMONumber        null.Int    `json:"imoNumber" db:"imo_number"`
+	Class            null.String `json:"class" db:"class"`
+	FeedID           null.Int    `json:"feedId" db:"feed_id"`
 	UpdatedAt        time.Time   `json:"updatedAt" db:"updated_at"`
 }
 
-func (db *DB) UpdateVessel(r nmeaais.DecoderOutput) {
+func (db *DB) UpdateVessel(r nmeaais.DecoderOutput, feedID int) {
 	switch dm := r.DecodedMessage.(type) {
 	case *nmeaais.PositionReportClassA:
-		err := db.UpdateVesselFromPositionReportClassA(dm)
+		start := time.Now()
+		err := db.UpdateVesselFromPositionReportClassA(dm, feedID)
+		observeDBWrite("vessel", start)
 		if err != nil {
 			slog.Error("Couldn't update vessel from PositionReportClassA", slog.Any("error", err))
+			break
 		}
+		db.observeVessel(&AlertObservation{
+			MMSI:             dm.MMSI,
+			Latitude:         null.NewFloat(dm.Latitude, dm.Latitude != 91),
+			Longitude:        null.NewFloat(dm.Longitude, dm.Longitude != 181),
+			Speed:            null.NewFloat(dm.SpeedOverGround, dm.SpeedOverGround < 102.3),
+			NavigationStatus: null.StringFrom(dm.NavigationStatus),
+		})
 	case *nmeaais.StaticAndVoyageRelatedData:
-		err := db.UpdateVesselFromStaticAndVoyageRelatedData(dm)
+		start := time.Now()
+		err := db.UpdateVesselFromStaticAndVoyageRelatedData(dm, feedID)
+		observeDBWrite("vessel", start)
 		if err != nil {
 			slog.Error("Couldn't update vessel from StaticAndVoyageRelatedData", slog.Any("error", err))
+			break
 		}
+		db.observeVessel(&AlertObservation{MMSI: dm.MMSI})
 	case *nmeaais.PositionReportClassBStandard:
-		err := db.UpdateVesselFromPositionReportClassBStandard(dm)
+		start := time.Now()
+		err := db.UpdateVesselFromPositionReportClassBStandard(dm, feedID)
+		observeDBWrite("vessel", start)
 		if err != nil {
 			slog.Error("Couldn't update vessel from PositionReportClassBStandard", slog.Any("error", err))
+			break
 		}
+		db.observeVessel(&AlertObservation{
+			MMSI:      dm.MMSI,
+			Latitude:  null.NewFloat(dm.Latitude, dm.Latitude != 91),
+			Longitude: null.NewFloat(dm.Longitude, dm.Longitude != 181),
+			Speed:     null.NewFloat(dm.SpeedOverGround, dm.SpeedOverGround < 102.3),
+		})
 	case *nmeaais.StaticDataReportA:
-		err := db.UpdateVesselFromStaticDataReportA(dm)
+		start := time.Now()
+		err := db.UpdateVesselFromStaticDataReportA(dm, feedID)
+		observeDBWrite("vessel", start)
 		if err != nil {
 			slog.Error("Couldn't update vessel from StaticDataReportA", slog.Any("error", err))
+			break
 		}
+		db.observeVessel(&AlertObservation{MMSI: dm.MMSI})
 	case *nmeaais.StaticDataReportB:
-		err := db.UpdateVesselFromStaticDataReportB(dm)
+		start := time.Now()
+		err := db.UpdateVesselFromStaticDataReportB(dm, feedID)
+		observeDBWrite("vessel", start)
 		if err != nil {
 			slog.Error("Couldn't update vessel from StaticDataReportB", slog.Any("error", err))
+			break
 		}
+		db.observeVessel(&AlertObservation{MMSI: dm.MMSI})
 	default:
 	}
 }
+
+// observeVessel hands what a stored message said about a vessel to the
+// alert engine.
+func (db *DB) observeVessel(o *AlertObservation) {
+	if db.Alerts != nil {
+		o.At = time.Now()
+		db.Alerts.Observe(o)
+	}
+}
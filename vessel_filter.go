@@ -0,0 +1,268 @@
+package ino
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/lib/pq"
+)
+
+// VesselFilter narrows down the vessels returned by the vessel list, in both
+// its JSON and GeoJSON forms. The zero value matches every vessel.
+type VesselFilter struct {
+	// BBox is min longitude, min latitude, max longitude, max latitude.
+	BBox []float64
+	// Polygon is a WKT or GeoJSON Polygon or MultiPolygon in WGS 84.
+	Polygon            string
+	SeenWithin         time.Duration
+	ShipTypes          []string
+	NavigationStatuses []string
+	MinSpeed           null.Float
+	MaxSpeed           null.Float
+	Class              string
+	FeedID             null.Int
+}
+
+// ParseVesselFilter reads a VesselFilter from query parameters:
+//
+//	bbox=minLon,minLat,maxLon,maxLat
+//	polygon=<WKT or GeoJSON Polygon or MultiPolygon>
+//	seen=<minutes>
+//	shipType=<type>&shipType=<type>
+//	navStatus=<status>&navStatus=<status>
+//	minSpeed=<knots>&maxSpeed=<knots>
+//	class=A|B
+//	feed=<feed id>
+func ParseVesselFilter(q url.Values) (*VesselFilter, error) {
+	f := &VesselFilter{
+		Polygon:            q.Get("polygon"),
+		ShipTypes:          q["shipType"],
+		NavigationStatuses: q["navStatus"],
+		Class:              strings.ToUpper(q.Get("class")),
+	}
+
+	if v := q.Get("bbox"); v != "" {
+		parts := strings.Split(v, ",")
+		if len(parts) != 4 {
+			return nil, badRequestf("ino: bbox needs 4 coordinates, got %v", len(parts))
+		}
+		for _, p := range parts {
+			c, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil, badRequestf("ino: invalid bbox coordinate '%v'", p)
+			}
+			f.BBox = append(f.BBox, c)
+		}
+	}
+
+	if f.Polygon != "" {
+		if _, err := parsePolygonFilter(f.Polygon); err != nil {
+			return nil, badRequestf("ino: invalid polygon: %v", err)
+		}
+	}
+
+	if v := q.Get("seen"); v != "" {
+		minutes, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, badRequestf("ino: invalid seen minutes '%v'", v)
+		}
+		f.SeenWithin = time.Duration(minutes * float64(time.Minute))
+	}
+
+	for name, target := range map[string]*null.Float{"minSpeed": &f.MinSpeed, "maxSpeed": &f.MaxSpeed} {
+		if v := q.Get(name); v != "" {
+			speed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, badRequestf("ino: invalid %v '%v'", name, v)
+			}
+			*target = null.FloatFrom(speed)
+		}
+	}
+
+	if f.Class != "" && f.Class != "A" && f.Class != "B" {
+		return nil, badRequestf("ino: invalid class '%v'", f.Class)
+	}
+
+	if v := q.Get("feed"); v != "" {
+		feedID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, badRequestf("ino: invalid feed '%v'", v)
+		}
+		f.FeedID = null.IntFrom(feedID)
+	}
+
+	return f, nil
+}
+
+// parsePolygonFilter reads a polygon filter the way where hands it to
+// PostGIS, so a malformed one is turned away before it gets there.
+func parsePolygonFilter(v string) ([]polygon, error) {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "{") {
+		return parseZoneGeometry([]byte(v))
+	}
+	return parseWKTPolygons(v)
+}
+
+// parseWKTPolygons reads the polygons out of a WKT POLYGON or MULTIPOLYGON.
+// Z and M values are allowed and ignored.
+func parseWKTPolygons(v string) ([]polygon, error) {
+	kind, rest, _ := strings.Cut(v, "(")
+	fields := strings.Fields(strings.ToUpper(kind))
+	if len(fields) == 0 || len(fields) > 2 || (len(fields) == 2 && fields[1] != "Z" && fields[1] != "M" && fields[1] != "ZM") {
+		return nil, fmt.Errorf("ino: WKT has to be a POLYGON or MULTIPOLYGON")
+	}
+
+	p := &wktParser{s: "(" + rest}
+	var polygons []polygon
+	switch fields[0] {
+	case "POLYGON":
+		poly, err := p.polygon()
+		if err != nil {
+			return nil, err
+		}
+		polygons = []polygon{poly}
+	case "MULTIPOLYGON":
+		err := p.list(func() error {
+			poly, err := p.polygon()
+			polygons = append(polygons, poly)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("ino: WKT has to be a POLYGON or MULTIPOLYGON, not '%v'", fields[0])
+	}
+
+	if rest := strings.TrimSpace(p.s); rest != "" {
+		return nil, fmt.Errorf("ino: unexpected '%v' after WKT", rest)
+	}
+	return polygons, nil
+}
+
+// wktParser eats its way through the parenthesized part of WKT.
+type wktParser struct {
+	s string
+}
+
+// list reads a parenthesized, comma separated list, calling item for each
+// element.
+func (p *wktParser) list(item func() error) error {
+	p.s = strings.TrimSpace(p.s)
+	if !strings.HasPrefix(p.s, "(") {
+		return fmt.Errorf("ino: WKT is missing a '('")
+	}
+	p.s = p.s[1:]
+	for {
+		if err := item(); err != nil {
+			return err
+		}
+		p.s = strings.TrimSpace(p.s)
+		switch {
+		case strings.HasPrefix(p.s, ","):
+			p.s = p.s[1:]
+		case strings.HasPrefix(p.s, ")"):
+			p.s = p.s[1:]
+			return nil
+		default:
+			return fmt.Errorf("ino: WKT is missing a ')'")
+		}
+	}
+}
+
+func (p *wktParser) polygon() (polygon, error) {
+	var poly polygon
+	err := p.list(func() error {
+		r, err := p.ring()
+		poly = append(poly, r)
+		return err
+	})
+	return poly, err
+}
+
+func (p *wktParser) ring() (ring, error) {
+	var r ring
+	err := p.list(func() error {
+		end := strings.IndexAny(p.s, ",)")
+		if end < 0 {
+			return fmt.Errorf("ino: WKT is missing a ')'")
+		}
+		point := p.s[:end]
+		p.s = p.s[end:]
+
+		coords := strings.Fields(point)
+		if len(coords) < 2 || len(coords) > 4 {
+			return fmt.Errorf("ino: invalid WKT point '%v'", strings.TrimSpace(point))
+		}
+		var pt [2]float64
+		for i := range pt {
+			c, err := strconv.ParseFloat(coords[i], 64)
+			if err != nil {
+				return fmt.Errorf("ino: invalid WKT coordinate '%v'", coords[i])
+			}
+			pt[i] = c
+		}
+		r = append(r, pt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(r) < 4 || r[0] != r[len(r)-1] {
+		return nil, fmt.Errorf("ino: WKT rings need at least 4 points and have to be closed")
+	}
+	return r, nil
+}
+
+// where renders the filter as a where clause over the vessel table, along
+// with its parameters numbered from $1.
+func (f *VesselFilter) where() (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(f.BBox) == 4 {
+		clauses = append(clauses, fmt.Sprintf("ST_Intersects(the_geog, ST_MakeEnvelope(%v, %v, %v, %v, 4326)::geography)", arg(f.BBox[0]), arg(f.BBox[1]), arg(f.BBox[2]), arg(f.BBox[3])))
+	}
+	if f.Polygon != "" {
+		if strings.HasPrefix(strings.TrimSpace(f.Polygon), "{") {
+			clauses = append(clauses, fmt.Sprintf("ST_Intersects(the_geog, ST_SetSRID(ST_GeomFromGeoJSON(%v), 4326)::geography)", arg(f.Polygon)))
+		} else {
+			clauses = append(clauses, fmt.Sprintf("ST_Intersects(the_geog, ST_GeomFromText(%v, 4326)::geography)", arg(f.Polygon)))
+		}
+	}
+	if f.SeenWithin > 0 {
+		clauses = append(clauses, fmt.Sprintf("updated_at > now() - make_interval(secs => %v)", arg(f.SeenWithin.Seconds())))
+	}
+	if len(f.ShipTypes) > 0 {
+		clauses = append(clauses, fmt.Sprintf("ship_type = any(%v)", arg(pq.Array(f.ShipTypes))))
+	}
+	if len(f.NavigationStatuses) > 0 {
+		clauses = append(clauses, fmt.Sprintf("navigation_status = any(%v)", arg(pq.Array(f.NavigationStatuses))))
+	}
+	if f.MinSpeed.Valid {
+		clauses = append(clauses, fmt.Sprintf("speed_over_ground >= %v", arg(f.MinSpeed.Float64)))
+	}
+	if f.MaxSpeed.Valid {
+		clauses = append(clauses, fmt.Sprintf("speed_over_ground <= %v", arg(f.MaxSpeed.Float64)))
+	}
+	if f.Class != "" {
+		clauses = append(clauses, fmt.Sprintf("class = %v", arg(f.Class)))
+	}
+	if f.FeedID.Valid {
+		clauses = append(clauses, fmt.Sprintf("feed_id = %v", arg(f.FeedID.Int64)))
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return "where " + strings.Join(clauses, " and "), args
+}
@@ -0,0 +1,221 @@
+package ino
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultVoyageLimit = 100
+	maxVoyageLimit     = 1000
+)
+
+// Voyage is a vessel's passage from one port call to the next. Either end
+// is missing when the vessel was first heard under way or hasn't arrived
+// yet.
+type Voyage struct {
+	VoyageID              int64       `json:"voyageId" db:"voyage_id"`
+	MMSI                  int64       `json:"mmsi" db:"mmsi"`
+	OriginPortCallID      null.Int    `json:"originPortCallId" db:"origin_port_call_id"`
+	OriginZoneID          null.Int    `json:"originZoneId" db:"origin_zone_id"`
+	OriginPort            null.String `json:"originPort" db:"origin_port"`
+	DestinationPortCallID null.Int    `json:"destinationPortCallId" db:"destination_port_call_id"`
+	DestinationZoneID     null.Int    `json:"destinationZoneId" db:"destination_zone_id"`
+	DestinationPort       null.String `json:"destinationPort" db:"destination_port"`
+	DepartedAt            time.Time   `json:"departedAt" db:"departed_at"`
+	ArrivedAt             null.Time   `json:"arrivedAt" db:"arrived_at"`
+	// Duration is in seconds, up to now for a voyage still under way.
+	Duration float64 `json:"duration" db:"duration"`
+	// Distance is in meters along the reported positions.
+	Distance  float64 `json:"distance" db:"distance"`
+	MaxSpeed  float64 `json:"maxSpeed" db:"max_speed"`
+	Positions int64   `json:"positions" db:"positions"`
+}
+
+// PortCall is a vessel stopping, alongside in a port or at anchor.
+type PortCall struct {
+	PortCallID int64       `json:"portCallId" db:"port_call_id"`
+	MMSI       int64       `json:"mmsi" db:"mmsi"`
+	VesselName null.String `json:"vesselName" db:"vessel_name"`
+	ZoneID     null.Int    `json:"zoneId" db:"zone_id"`
+	Port       null.String `json:"port" db:"port"`
+	Kind       string      `json:"kind" db:"kind"`
+	Latitude   float64     `json:"latitude" db:"latitude"`
+	Longitude  float64     `json:"longitude" db:"longitude"`
+	ArrivedAt  time.Time   `json:"arrivedAt" db:"arrived_at"`
+	DepartedAt null.Time   `json:"departedAt" db:"departed_at"`
+	// Duration is in seconds, up to now for a vessel that's still there.
+	Duration float64 `json:"duration" db:"duration"`
+}
+
+// VoyageFilter narrows down voyages and port calls. Both are matched by
+// whether they overlap the time range.
+type VoyageFilter eventFilter
+
+// ParseVoyageFilter reads a VoyageFilter from query parameters:
+//
+//	kind=port,anchorage
+//	mmsi=<mmsi>
+//	from=<RFC 3339>&to=<RFC 3339>
+//	limit=<count, default 100>
+func ParseVoyageFilter(q url.Values) (*VoyageFilter, error) {
+	f, err := parseEventFilter(q, []string{PortCallPort, PortCallAnchorage}, defaultVoyageLimit, maxVoyageLimit)
+	if err != nil {
+		return nil, err
+	}
+	filter := VoyageFilter(f)
+	return &filter, nil
+}
+
+// GetVoyagesForVessel lists a vessel's voyages, newest first.
+func (db *DB) GetVoyagesForVessel(mmsi int, f *VoyageFilter) ([]*Voyage, error) {
+	args := []interface{}{mmsi}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	clauses := []string{"v.mmsi = $1"}
+	if f.From.Valid {
+		clauses = append(clauses, fmt.Sprintf("(v.arrived_at is null or v.arrived_at >= %v)", arg(f.From)))
+	}
+	if f.To.Valid {
+		clauses = append(clauses, fmt.Sprintf("v.departed_at < %v", arg(f.To)))
+	}
+
+	voyages := []*Voyage{}
+	err := db.Select(&voyages, `
+		select
+			v.voyage_id,
+			v.mmsi,
+			v.origin_port_call_id,
+			o.zone_id origin_zone_id,
+			oz.name origin_port,
+			v.destination_port_call_id,
+			d.zone_id destination_zone_id,
+			dz.name destination_port,
+			v.departed_at,
+			v.arrived_at,
+			extract(epoch from coalesce(v.arrived_at, now()) - v.departed_at)::double precision duration,
+			v.distance,
+			v.max_speed,
+			v.positions
+		from
+			voyage v
+			left join port_call o on o.port_call_id = v.origin_port_call_id
+			left join zone oz on oz.zone_id = o.zone_id
+			left join port_call d on d.port_call_id = v.destination_port_call_id
+			left join zone dz on dz.zone_id = d.zone_id
+		where
+			`+strings.Join(clauses, " and ")+`
+		order by
+			v.departed_at desc,
+			v.voyage_id desc
+		limit `+arg(f.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	return voyages, nil
+}
+
+// GetPortCalls lists the calls at a port, newest first.
+func (db *DB) GetPortCalls(zoneID int, f *VoyageFilter) ([]*PortCall, error) {
+	args := []interface{}{zoneID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	clauses := []string{"p.zone_id = $1"}
+	if len(f.Kinds) > 0 {
+		clauses = append(clauses, fmt.Sprintf("p.kind = any(%v)", arg(pq.Array(f.Kinds))))
+	}
+	if f.MMSI.Valid {
+		clauses = append(clauses, fmt.Sprintf("p.mmsi = %v", arg(f.MMSI)))
+	}
+	if f.From.Valid {
+		clauses = append(clauses, fmt.Sprintf("(p.departed_at is null or p.departed_at >= %v)", arg(f.From)))
+	}
+	if f.To.Valid {
+		clauses = append(clauses, fmt.Sprintf("p.arrived_at < %v", arg(f.To)))
+	}
+
+	calls := []*PortCall{}
+	err := db.Select(&calls, `
+		select
+			p.port_call_id,
+			p.mmsi,
+			v.vessel_name,
+			p.zone_id,
+			z.name port,
+			p.kind,
+			p.latitude,
+			p.longitude,
+			p.arrived_at,
+			p.departed_at,
+			extract(epoch from coalesce(p.departed_at, now()) - p.arrived_at)::double precision duration
+		from
+			port_call p
+			left join zone z on z.zone_id = p.zone_id
+			left join vessel v on v.mmsi = p.mmsi
+		where
+			`+strings.Join(clauses, " and ")+`
+		order by
+			p.arrived_at desc,
+			p.port_call_id desc
+		limit `+arg(f.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+func (s *HTTPServer) GetVoyagesForVessel(w http.ResponseWriter, r *http.Request) error {
+	mmsi, err := urlParamInt(r, "mmsi")
+	if err != nil {
+		return err
+	}
+
+	filter, err := ParseVoyageFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	voyages, err := s.DB.GetVoyagesForVessel(mmsi, filter)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, voyages)
+	return nil
+}
+
+func (s *HTTPServer) GetPortCalls(w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	filter, err := ParseVoyageFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetZone(zoneID); err != nil {
+		return err
+	}
+
+	calls, err := s.DB.GetPortCalls(zoneID, filter)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, calls)
+	return nil
+}
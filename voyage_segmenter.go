@@ -0,0 +1,474 @@
+package ino
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// voyageBatch is how many position reports are segmented per
+	// transaction.
+	voyageBatch = 50000
+
+	PortCallPort      = "port"
+	PortCallAnchorage = "anchorage"
+)
+
+type VoyageOptions struct {
+	// PortTag marks the zones that are ports.
+	PortTag string
+	// StopSpeed is the speed, in knots, below which a vessel counts as
+	// stopped.
+	StopSpeed float64
+	// DepartSpeed is the speed a stopped vessel has to get up to before it
+	// counts as leaving. It's above StopSpeed so a vessel shifting at its
+	// berth doesn't leave and arrive over and over.
+	DepartSpeed float64
+	// MinStop is how long a vessel has to stay stopped before it counts as
+	// having arrived.
+	MinStop time.Duration
+}
+
+// VoyageSegmenter splits each vessel's position reports into voyages and
+// the port calls and anchorages between them. A vessel arrives once it has
+// been stopped, or reporting itself moored or at anchor, for MinStop, and
+// departs once it's under way again, having left the port if it stopped in
+// one.
+type VoyageSegmenter struct {
+	DB      *DB
+	options VoyageOptions
+	job     *periodicJob
+}
+
+func NewVoyageSegmenter(db *DB, options *VoyageOptions) *VoyageSegmenter {
+	s := &VoyageSegmenter{
+		DB:      db,
+		options: *options,
+		job:     newPeriodicJob(),
+	}
+	return s
+}
+
+// Start segments new position reports every interval until Shutdown is
+// called.
+func (s *VoyageSegmenter) Start(interval time.Duration) {
+	s.job.start(interval, "Couldn't segment voyages", s.Run)
+}
+
+func (s *VoyageSegmenter) Shutdown() {
+	s.job.stop()
+}
+
+// Run segments every position report that's settled, a batch at a time.
+func (s *VoyageSegmenter) Run() error {
+	zones, err := s.DB.GetZones(s.options.PortTag)
+	if err != nil {
+		return err
+	}
+	indexed := make([]*indexedZone, 0, len(zones))
+	for _, z := range zones {
+		polygons, err := parseZoneGeometry(z.Geometry)
+		if err != nil {
+			slog.Error("Couldn't index port", "zoneId", z.ZoneID, slog.Any("error", err))
+			continue
+		}
+		indexed = append(indexed, newIndexedZone(z.ZoneID, polygons))
+	}
+	ports := newZoneIndex(indexed)
+
+	total := 0
+	for {
+		n, err := s.segment(ports)
+		if err != nil {
+			return err
+		}
+		total += n
+		if n == 0 {
+			break
+		}
+		if s.job.stopping() {
+			return nil
+		}
+	}
+	if total > 0 {
+		slog.Debug("Segmented position reports", "count", total)
+	}
+	return nil
+}
+
+// voyageReading is a position report, as far as segmenting is concerned.
+type voyageReading struct {
+	MessageID        int64       `db:"message_id"`
+	MMSI             int64       `db:"mmsi"`
+	At               time.Time   `db:"created_at"`
+	Latitude         float64     `db:"latitude"`
+	Longitude        float64     `db:"longitude"`
+	Speed            null.Float  `db:"speed"`
+	NavigationStatus null.String `db:"navigation_status"`
+}
+
+// voyageTrack is where segmenting a vessel got to: the voyage or port call
+// it's in, and whether it has stopped.
+type voyageTrack struct {
+	MMSI             int64       `db:"mmsi"`
+	VoyageID         null.Int    `db:"voyage_id"`
+	PortCallID       null.Int    `db:"port_call_id"`
+	PortCallKind     null.String `db:"port_call_kind"`
+	PortZoneID       null.Int    `db:"port_zone_id"`
+	StoppedSince     null.Time   `db:"stopped_since"`
+	StoppedLatitude  null.Float  `db:"stopped_latitude"`
+	StoppedLongitude null.Float  `db:"stopped_longitude"`
+	LastLatitude     null.Float  `db:"last_latitude"`
+	LastLongitude    null.Float  `db:"last_longitude"`
+	LastAt           null.Time   `db:"last_at"`
+	// Distance, MaxSpeed and Positions are the open voyage's so far.
+	Distance  float64 `db:"distance"`
+	MaxSpeed  float64 `db:"max_speed"`
+	Positions int64   `db:"positions"`
+}
+
+// segment works through up to voyageBatch position reports past the last
+// one segmented, returning how many it did.
+func (s *VoyageSegmenter) segment(ports *zoneIndex) (int, error) {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var last int64
+	err = tx.QueryRow("select last_message_id from voyage_state for update").Scan(&last)
+	if err != nil {
+		return 0, err
+	}
+
+	// Latitude 91 and longitude 181 mean the position isn't available, and a
+	// speed of 102.3 that the speed isn't.
+	readings := []*voyageReading{}
+	err = tx.Select(&readings, `
+		select
+			message_id,
+			mmsi,
+			created_at,
+			latitude,
+			longitude,
+			nullif(speed, 102.3) speed,
+			navigation_status
+		from
+		(
+			select
+				message_id,
+				mmsi,
+				created_at,
+				coalesce((message->>'Latitude')::double precision, 91) latitude,
+				coalesce((message->>'Longitude')::double precision, 181) longitude,
+				(message->>'SpeedOverGround')::double precision speed,
+				message->>'NavigationStatus' navigation_status
+			from
+				message
+			where
+				message_id > $1
+				and created_at < now() - make_interval(secs => $3)
+				and type in (1, 2, 3, 18, 19)
+			order by
+				message_id
+			limit $2
+		) m
+	`, last, voyageBatch, settleLag.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	if len(readings) == 0 {
+		return 0, nil
+	}
+
+	mmsis := []int64{}
+	seen := map[int64]bool{}
+	for _, r := range readings {
+		if !seen[r.MMSI] {
+			seen[r.MMSI] = true
+			mmsis = append(mmsis, r.MMSI)
+		}
+	}
+
+	loaded := []*voyageTrack{}
+	err = tx.Select(&loaded, `
+		select
+			t.mmsi,
+			t.voyage_id,
+			t.port_call_id,
+			p.kind port_call_kind,
+			p.zone_id port_zone_id,
+			t.stopped_since,
+			t.stopped_latitude,
+			t.stopped_longitude,
+			t.last_latitude,
+			t.last_longitude,
+			t.last_at,
+			coalesce(v.distance, 0) distance,
+			coalesce(v.max_speed, 0) max_speed,
+			coalesce(v.positions, 0) positions
+		from
+			voyage_track t
+			left join port_call p on p.port_call_id = t.port_call_id
+			left join voyage v on v.voyage_id = t.voyage_id
+		where
+			t.mmsi = any($1)
+	`, pq.Array(mmsis))
+	if err != nil {
+		return 0, err
+	}
+	tracks := make(map[int64]*voyageTrack, len(mmsis))
+	for _, t := range loaded {
+		tracks[t.MMSI] = t
+	}
+
+	for _, r := range readings {
+		if r.Latitude == 91 || r.Longitude == 181 {
+			continue
+		}
+		t, ok := tracks[r.MMSI]
+		if !ok {
+			t = &voyageTrack{MMSI: r.MMSI}
+			tracks[r.MMSI] = t
+		}
+		if err := s.step(tx, ports, t, r); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := saveVoyageTracks(tx, tracks); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("update voyage_state set last_message_id = $1, updated_at = now()", readings[len(readings)-1].MessageID)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(readings), tx.Commit()
+}
+
+// voyageAction is what a position report leaves to be written for a
+// vessel's track, beyond the track itself.
+type voyageAction int
+
+const (
+	voyageNone voyageAction = iota
+	voyageOpen
+	voyageArrive
+	voyageDepart
+)
+
+// voyageChange is the outcome of a position report. The port call's zone
+// and kind are only set when the vessel arrives.
+type voyageChange struct {
+	action       voyageAction
+	zoneID       null.Int
+	portCallKind string
+}
+
+// step moves a vessel's track on by one position report.
+func (s *VoyageSegmenter) step(tx *sqlx.Tx, ports *zoneIndex, t *voyageTrack, r *voyageReading) error {
+	c := s.advance(ports, t, r)
+	switch c.action {
+	case voyageOpen:
+		return openVoyage(tx, t, null.Int{}, r.At)
+	case voyageArrive:
+		return arrivePortCall(tx, t, c.zoneID, c.portCallKind)
+	case voyageDepart:
+		return departPortCall(tx, t, r.At)
+	}
+	return nil
+}
+
+// advance works out what a position report means for a vessel's track,
+// updating what's kept in the track itself and leaving voyages and port
+// calls to be started and ended by the caller.
+func (s *VoyageSegmenter) advance(ports *zoneIndex, t *voyageTrack, r *voyageReading) voyageChange {
+	if t.LastAt.Valid && r.At.Before(t.LastAt.Time) {
+		// Messages are stored concurrently, so an older one can turn up after
+		// a newer one.
+		return voyageChange{}
+	}
+
+	berthed := r.NavigationStatus.String == "Moored" || r.NavigationStatus.String == "At anchor"
+	stopped := berthed || (r.Speed.Valid && r.Speed.Float64 < s.options.StopSpeed)
+	underway := !berthed && r.Speed.Valid && r.Speed.Float64 >= s.options.DepartSpeed
+
+	if t.VoyageID.Valid && t.LastLatitude.Valid && t.LastLongitude.Valid {
+		t.Distance += distance(t.LastLatitude.Float64, t.LastLongitude.Float64, r.Latitude, r.Longitude)
+		t.Positions++
+		if r.Speed.Valid && r.Speed.Float64 > t.MaxSpeed {
+			t.MaxSpeed = r.Speed.Float64
+		}
+	}
+	t.LastLatitude = null.FloatFrom(r.Latitude)
+	t.LastLongitude = null.FloatFrom(r.Longitude)
+	t.LastAt = null.TimeFrom(r.At)
+
+	if t.PortCallID.Valid {
+		// A vessel can move about inside a port, between berths or from the
+		// anchorage in, so it's only gone once it's outside.
+		if !underway {
+			return voyageChange{}
+		}
+		if t.PortCallKind.String == PortCallPort && t.PortZoneID.Valid && ports.containing(r.Longitude, r.Latitude)[t.PortZoneID.Int64] {
+			return voyageChange{}
+		}
+		return voyageChange{action: voyageDepart}
+	}
+
+	if !stopped {
+		if underway {
+			t.StoppedSince = null.Time{}
+		}
+		if !t.VoyageID.Valid {
+			return voyageChange{action: voyageOpen}
+		}
+		return voyageChange{}
+	}
+
+	if !t.StoppedSince.Valid {
+		t.StoppedSince = null.TimeFrom(r.At)
+		t.StoppedLatitude = null.FloatFrom(r.Latitude)
+		t.StoppedLongitude = null.FloatFrom(r.Longitude)
+	}
+	if r.At.Sub(t.StoppedSince.Time) < s.options.MinStop {
+		return voyageChange{}
+	}
+
+	// Where a vessel stopped decides which port it called at; it's at anchor
+	// if it says so, or if it stopped outside every port.
+	var zoneID null.Int
+	for id := range ports.containing(t.StoppedLongitude.Float64, t.StoppedLatitude.Float64) {
+		if !zoneID.Valid || id < zoneID.Int64 {
+			zoneID = null.IntFrom(id)
+		}
+	}
+	kind := PortCallPort
+	if !zoneID.Valid || r.NavigationStatus.String == "At anchor" {
+		kind = PortCallAnchorage
+	}
+	return voyageChange{action: voyageArrive, zoneID: zoneID, portCallKind: kind}
+}
+
+// arrivePortCall starts a port call where and when the vessel stopped,
+// ending the voyage that brought it there.
+func arrivePortCall(tx *sqlx.Tx, t *voyageTrack, zoneID null.Int, kind string) error {
+	var portCallID int64
+	err := tx.QueryRow(`
+		insert into port_call (mmsi, zone_id, kind, latitude, longitude, arrived_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning port_call_id
+	`, t.MMSI, zoneID, kind, t.StoppedLatitude, t.StoppedLongitude, t.StoppedSince).Scan(&portCallID)
+	if err != nil {
+		return err
+	}
+
+	if t.VoyageID.Valid {
+		_, err = tx.Exec(`
+			update voyage
+			set
+				destination_port_call_id = $2,
+				arrived_at = $3,
+				distance = $4,
+				max_speed = $5,
+				positions = $6
+			where
+				voyage_id = $1
+		`, t.VoyageID, portCallID, t.StoppedSince, t.Distance, t.MaxSpeed, t.Positions)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.VoyageID = null.Int{}
+	t.PortCallID = null.IntFrom(portCallID)
+	t.PortCallKind = null.StringFrom(kind)
+	t.PortZoneID = zoneID
+	t.StoppedSince = null.Time{}
+	t.StoppedLatitude = null.Float{}
+	t.StoppedLongitude = null.Float{}
+	return nil
+}
+
+// departPortCall ends the vessel's port call and starts a voyage from it.
+func departPortCall(tx *sqlx.Tx, t *voyageTrack, at time.Time) error {
+	_, err := tx.Exec("update port_call set departed_at = $2 where port_call_id = $1", t.PortCallID, at)
+	if err != nil {
+		return err
+	}
+
+	origin := t.PortCallID
+	t.PortCallID = null.Int{}
+	t.PortCallKind = null.String{}
+	t.PortZoneID = null.Int{}
+	return openVoyage(tx, t, origin, at)
+}
+
+func openVoyage(tx *sqlx.Tx, t *voyageTrack, origin null.Int, at time.Time) error {
+	var voyageID int64
+	err := tx.QueryRow(`
+		insert into voyage (mmsi, origin_port_call_id, departed_at)
+		values ($1, $2, $3)
+		returning voyage_id
+	`, t.MMSI, origin, at).Scan(&voyageID)
+	if err != nil {
+		return err
+	}
+
+	t.VoyageID = null.IntFrom(voyageID)
+	t.Distance = 0
+	t.MaxSpeed = 0
+	t.Positions = 0
+	return nil
+}
+
+// saveVoyageTracks stores where each vessel's track got to, along with its
+// open voyage's figures so far.
+func saveVoyageTracks(tx *sqlx.Tx, tracks map[int64]*voyageTrack) error {
+	saveTrack, err := tx.Preparex(`
+		insert into voyage_track
+		(mmsi, voyage_id, port_call_id, stopped_since, stopped_latitude, stopped_longitude, last_latitude, last_longitude, last_at)
+		values
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		on conflict (mmsi)
+		do update set
+			voyage_id = EXCLUDED.voyage_id,
+			port_call_id = EXCLUDED.port_call_id,
+			stopped_since = EXCLUDED.stopped_since,
+			stopped_latitude = EXCLUDED.stopped_latitude,
+			stopped_longitude = EXCLUDED.stopped_longitude,
+			last_latitude = EXCLUDED.last_latitude,
+			last_longitude = EXCLUDED.last_longitude,
+			last_at = EXCLUDED.last_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer saveTrack.Close()
+
+	saveVoyage, err := tx.Preparex("update voyage set distance = $2, max_speed = $3, positions = $4 where voyage_id = $1")
+	if err != nil {
+		return err
+	}
+	defer saveVoyage.Close()
+
+	for _, t := range tracks {
+		_, err := saveTrack.Exec(t.MMSI, t.VoyageID, t.PortCallID, t.StoppedSince, t.StoppedLatitude, t.StoppedLongitude, t.LastLatitude, t.LastLongitude, t.LastAt)
+		if err != nil {
+			return err
+		}
+		if t.VoyageID.Valid {
+			if _, err := saveVoyage.Exec(t.VoyageID, t.Distance, t.MaxSpeed, t.Positions); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
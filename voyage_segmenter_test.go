@@ -0,0 +1,151 @@
+package ino
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guregu/null/v5"
+)
+
+func TestVoyageSegmenterAdvance(t *testing.T) {
+	s := NewVoyageSegmenter(nil, &VoyageOptions{
+		StopSpeed:   0.5,
+		DepartSpeed: 2,
+		MinStop:     10 * time.Minute,
+	})
+	// Port 7 is the square between 0 and 1 east, 50 and 51 north.
+	polygons, err := parseZoneGeometry([]byte(`{"type":"Polygon","coordinates":[[[0,50],[1,50],[1,51],[0,51],[0,50]]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := newZoneIndex([]*indexedZone{newIndexedZone(7, polygons)})
+
+	start := time.Unix(1700000000, 0)
+	inPort := func(at time.Duration, speed float64, status string) *voyageReading {
+		return &voyageReading{At: start.Add(at), Latitude: 50.5, Longitude: 0.5, Speed: null.FloatFrom(speed), NavigationStatus: null.StringFrom(status)}
+	}
+	atSea := func(at time.Duration, speed float64, status string) *voyageReading {
+		return &voyageReading{At: start.Add(at), Latitude: 49, Longitude: -3, Speed: null.FloatFrom(speed), NavigationStatus: null.StringFrom(status)}
+	}
+	voyage := func() *voyageTrack {
+		return &voyageTrack{VoyageID: null.IntFrom(1), LastLatitude: null.FloatFrom(49.1), LastLongitude: null.FloatFrom(-3), LastAt: null.TimeFrom(start)}
+	}
+	stoppedAt := func(r *voyageReading) *voyageTrack {
+		tr := voyage()
+		tr.StoppedSince = null.TimeFrom(r.At)
+		tr.StoppedLatitude = null.FloatFrom(r.Latitude)
+		tr.StoppedLongitude = null.FloatFrom(r.Longitude)
+		return tr
+	}
+	portCall := func(kind string) *voyageTrack {
+		return &voyageTrack{PortCallID: null.IntFrom(2), PortCallKind: null.StringFrom(kind), PortZoneID: null.IntFrom(7), LastAt: null.TimeFrom(start)}
+	}
+
+	cases := []struct {
+		name    string
+		track   *voyageTrack
+		reading *voyageReading
+		want    voyageChange
+		// stopped is whether the track should have a stop under way after.
+		stopped   bool
+		positions int64
+	}{
+		{
+			name:    "first heard under way",
+			track:   &voyageTrack{},
+			reading: atSea(0, 10, "Under way using engine"),
+			want:    voyageChange{action: voyageOpen},
+		},
+		{
+			name:      "under way on a voyage",
+			track:     voyage(),
+			reading:   atSea(time.Minute, 10, "Under way using engine"),
+			positions: 1,
+		},
+		{
+			name:    "older than the last report",
+			track:   voyage(),
+			reading: atSea(-time.Minute, 0, "Moored"),
+		},
+		{
+			name:      "slowing down",
+			track:     voyage(),
+			reading:   inPort(time.Minute, 0.1, "Under way using engine"),
+			stopped:   true,
+			positions: 1,
+		},
+		{
+			name:      "drifting between stop and depart speeds",
+			track:     stoppedAt(inPort(0, 0.1, "")),
+			reading:   inPort(time.Minute, 1, "Under way using engine"),
+			stopped:   true,
+			positions: 1,
+		},
+		{
+			name:      "under way again before the stop counts",
+			track:     stoppedAt(inPort(0, 0.1, "")),
+			reading:   inPort(time.Minute, 5, "Under way using engine"),
+			positions: 1,
+		},
+		{
+			name:      "stopped in port long enough",
+			track:     stoppedAt(inPort(0, 0.1, "")),
+			reading:   inPort(10*time.Minute, 0.1, "Moored"),
+			want:      voyageChange{action: voyageArrive, zoneID: null.IntFrom(7), portCallKind: PortCallPort},
+			stopped:   true,
+			positions: 1,
+		},
+		{
+			name:      "at anchor in port",
+			track:     stoppedAt(inPort(0, 0.1, "")),
+			reading:   inPort(10*time.Minute, 0.1, "At anchor"),
+			want:      voyageChange{action: voyageArrive, zoneID: null.IntFrom(7), portCallKind: PortCallAnchorage},
+			stopped:   true,
+			positions: 1,
+		},
+		{
+			name:      "stopped outside every port",
+			track:     stoppedAt(atSea(0, 0.1, "")),
+			reading:   atSea(10*time.Minute, 0.1, ""),
+			want:      voyageChange{action: voyageArrive, portCallKind: PortCallAnchorage},
+			stopped:   true,
+			positions: 1,
+		},
+		{
+			name:    "moving between berths",
+			track:   portCall(PortCallPort),
+			reading: inPort(time.Minute, 5, "Under way using engine"),
+		},
+		{
+			name:    "leaving port",
+			track:   portCall(PortCallPort),
+			reading: atSea(time.Minute, 5, "Under way using engine"),
+			want:    voyageChange{action: voyageDepart},
+		},
+		{
+			name:    "weighing anchor in port",
+			track:   portCall(PortCallAnchorage),
+			reading: inPort(time.Minute, 5, "Under way using engine"),
+			want:    voyageChange{action: voyageDepart},
+		},
+		{
+			name:    "moored but reporting speed",
+			track:   portCall(PortCallPort),
+			reading: atSea(time.Minute, 5, "Moored"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := s.advance(ports, c.track, c.reading)
+			if got != c.want {
+				t.Errorf("change %+v, want %+v", got, c.want)
+			}
+			if c.track.StoppedSince.Valid != c.stopped {
+				t.Errorf("stopped %v, want %v", c.track.StoppedSince.Valid, c.stopped)
+			}
+			if c.track.Positions != c.positions {
+				t.Errorf("%v positions, want %v", c.track.Positions, c.positions)
+			}
+		})
+	}
+}
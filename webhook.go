@@ -0,0 +1,488 @@
+package ino
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+const (
+	AlertDeliveryPending   = "pending"
+	AlertDeliveryDelivered = "delivered"
+	AlertDeliveryFailed    = "failed"
+
+	// webhookSignatureHeader carries the signature receivers check a webhook
+	// against.
+	webhookSignatureHeader = "X-Ino-Signature"
+	webhookDeliveryHeader  = "X-Ino-Delivery"
+	// webhookTolerance is how old a signature can be before VerifyWebhook
+	// turns it away, so captured webhooks can't be replayed later.
+	webhookTolerance = 5 * time.Minute
+	// webhookBatch is how many due deliveries are picked up per pass.
+	webhookBatch = 100
+	// webhookHostConcurrency is how many webhooks can be in flight to one
+	// host at once, so a slow receiver holds up its own deliveries but not
+	// everyone else's.
+	webhookHostConcurrency = 4
+	// maxWebhookError is how much of a failed response's body is kept.
+	maxWebhookError = 1024
+)
+
+// AlertDelivery is a webhook queued for a rule, with every attempt at
+// sending it.
+type AlertDelivery struct {
+	AlertDeliveryID int64                   `json:"alertDeliveryId" db:"alert_delivery_id"`
+	AlertRuleID     int64                   `json:"alertRuleId" db:"alert_rule_id"`
+	Payload         types.JSONText          `json:"payload" db:"payload"`
+	Status          string                  `json:"status" db:"status"`
+	Attempts        int                     `json:"attempts" db:"attempts"`
+	NextAttemptAt   null.Time               `json:"nextAttemptAt" db:"next_attempt_at"`
+	DeliveredAt     null.Time               `json:"deliveredAt" db:"delivered_at"`
+	CreatedAt       time.Time               `json:"createdAt" db:"created_at"`
+	Log             []*AlertDeliveryAttempt `json:"log" db:"-"`
+}
+
+type AlertDeliveryAttempt struct {
+	AlertDeliveryAttemptID int64       `json:"alertDeliveryAttemptId" db:"alert_delivery_attempt_id"`
+	AlertDeliveryID        int64       `json:"alertDeliveryId" db:"alert_delivery_id"`
+	Attempt                int         `json:"attempt" db:"attempt"`
+	StatusCode             null.Int    `json:"statusCode" db:"status_code"`
+	Error                  null.String `json:"error" db:"error"`
+	DurationMS             int64       `json:"durationMs" db:"duration_ms"`
+	CreatedAt              time.Time   `json:"createdAt" db:"created_at"`
+}
+
+// dueDelivery is a delivery ready to send, with where to send it.
+type dueDelivery struct {
+	AlertDeliveryID int64          `db:"alert_delivery_id"`
+	Payload         types.JSONText `db:"payload"`
+	Attempts        int            `db:"attempts"`
+	WebhookURL      string         `db:"webhook_url"`
+	Secret          string         `db:"secret"`
+}
+
+// SignWebhook signs a webhook body sent at t, giving the value of its
+// X-Ino-Signature header. The signature is an HMAC-SHA256, keyed by the
+// rule's secret, of the unix time, a full stop, and the body.
+func SignWebhook(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + webhookMAC(secret, ts, body)
+}
+
+// VerifyWebhook checks a webhook's X-Ino-Signature header against its
+// body, for receivers.
+func VerifyWebhook(secret string, header string, body []byte, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("ino: malformed webhook signature '%v'", header)
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return fmt.Errorf("ino: webhook signature is %v old", age.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookMAC(secret, ts, body))) {
+		return fmt.Errorf("ino: webhook signature doesn't match")
+	}
+	return nil
+}
+
+func webhookMAC(secret string, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Start sends queued webhooks as they come in, and retries failed ones,
+// until Shutdown is called.
+func (e *AlertEngine) Start() {
+	go func() {
+		defer close(e.stopped)
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		for {
+			if err := e.Dispatch(); err != nil {
+				slog.Error("Couldn't send alerts", slog.Any("error", err))
+			}
+			select {
+			case <-t.C:
+			case <-e.wake:
+			case <-e.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops sending webhooks, waiting for any being sent to finish.
+func (e *AlertEngine) Shutdown() {
+	close(e.shutdown)
+	<-e.stopped
+	e.sends.Wait()
+}
+
+// Dispatch starts sending the deliveries that are due, in the background,
+// as far as each host's limit on webhooks in flight allows. The rest are
+// picked up by a later pass once a send finishes.
+func (e *AlertEngine) Dispatch() error {
+	e.sendMu.Lock()
+	inflight := make([]int64, 0, len(e.inflight))
+	for id := range e.inflight {
+		inflight = append(inflight, id)
+	}
+	busy := []string{}
+	for host, n := range e.hosts {
+		if n >= webhookHostConcurrency {
+			busy = append(busy, host)
+		}
+	}
+	e.sendMu.Unlock()
+
+	due, err := e.DB.GetDueAlertDeliveries(webhookBatch, webhookHostConcurrency, inflight, busy)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		host := webhookHost(d.WebhookURL)
+
+		e.sendMu.Lock()
+		if e.hosts[host] >= webhookHostConcurrency {
+			e.sendMu.Unlock()
+			continue
+		}
+		e.hosts[host]++
+		e.inflight[d.AlertDeliveryID] = true
+		e.sendMu.Unlock()
+
+		e.sends.Add(1)
+		go func(d *dueDelivery) {
+			defer e.sends.Done()
+			if err := e.send(d); err != nil {
+				slog.Error("Couldn't record alert delivery", "alertDeliveryId", d.AlertDeliveryID, slog.Any("error", err))
+			}
+
+			e.sendMu.Lock()
+			e.hosts[host]--
+			if e.hosts[host] == 0 {
+				delete(e.hosts, host)
+			}
+			delete(e.inflight, d.AlertDeliveryID)
+			e.sendMu.Unlock()
+
+			// Whatever was waiting on this host can go now.
+			select {
+			case e.wake <- struct{}{}:
+			default:
+			}
+		}(d)
+	}
+	return nil
+}
+
+// webhookHost is what deliveries are limited by, the host and port they're
+// sent to. webhookHostSQL works it out the same way in the database.
+func webhookHost(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+	return u.Host
+}
+
+// send makes one attempt at a delivery, logging it and scheduling the next
+// if it failed.
+func (e *AlertEngine) send(d *dueDelivery) error {
+	attempt := d.Attempts + 1
+	start := time.Now()
+	statusCode, sendErr := e.post(d, start)
+	took := time.Since(start)
+
+	status := AlertDeliveryDelivered
+	var next null.Time
+	if sendErr != nil {
+		status = AlertDeliveryFailed
+		if attempt < e.options.MaxAttempts {
+			status = AlertDeliveryPending
+			next = null.TimeFrom(time.Now().Add(e.backoff(attempt)))
+		}
+		slog.Warn("Couldn't deliver alert", "alertDeliveryId", d.AlertDeliveryID, "attempt", attempt, "status", status, slog.Any("error", sendErr))
+	}
+
+	return e.DB.RecordAlertDeliveryAttempt(d.AlertDeliveryID, attempt, status, next, statusCode, sendErr, took)
+}
+
+func (e *AlertEngine) post(d *dueDelivery, now time.Time) (null.Int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.WebhookURL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return null.Int{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ino")
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(d.AlertDeliveryID, 10))
+	req.Header.Set(webhookSignatureHeader, SignWebhook(d.Secret, now, d.Payload))
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return null.Int{}, err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxWebhookError))
+
+	statusCode := null.IntFrom(int64(res.StatusCode))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusCode, fmt.Errorf("ino: webhook responded %v: %s", res.Status, bytes.TrimSpace(body))
+	}
+	return statusCode, nil
+}
+
+// backoff is how long to wait after a failed attempt, doubling each time up
+// to the maximum, with up to a fifth taken off at random so deliveries that
+// failed together don't all retry together.
+func (e *AlertEngine) backoff(attempt int) time.Duration {
+	d := time.Duration(float64(e.options.Backoff) * math.Pow(2, float64(attempt-1)))
+	if d <= 0 || d > e.options.MaxBackoff {
+		d = e.options.MaxBackoff
+	}
+	return d - time.Duration(mathrand.Int63n(int64(d)/5+1))
+}
+
+func (db *DB) AddAlertDelivery(ruleID int64, payload []byte) (*AlertDelivery, error) {
+	d := &AlertDelivery{Log: []*AlertDeliveryAttempt{}}
+	err := db.Get(d, `
+		insert into alert_delivery (alert_rule_id, payload)
+		values ($1, $2)
+		returning
+			alert_delivery_id,
+			alert_rule_id,
+			payload,
+			status,
+			attempts,
+			next_attempt_at,
+			delivered_at,
+			created_at
+	`, ruleID, types.JSONText(payload))
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// webhookHostSQL is webhookHost for a webhook_url column.
+const webhookHostSQL = `coalesce(substring(r.webhook_url from '^[^:/?#]+://(?:[^@/?#]*@)?([^/?#]*)'), r.webhook_url)`
+
+// GetDueAlertDeliveries returns the pending deliveries whose next attempt
+// is due, oldest first, leaving out the ones already being sent and those
+// for busy hosts. No more than perHost are returned for any one host, so a
+// host with a backlog can't take up the whole batch.
+func (db *DB) GetDueAlertDeliveries(limit int, perHost int, inflight []int64, busy []string) ([]*dueDelivery, error) {
+	due := []*dueDelivery{}
+	err := db.Select(&due, `
+		select
+			alert_delivery_id,
+			payload,
+			attempts,
+			webhook_url,
+			secret
+		from
+		(
+			select
+				d.alert_delivery_id,
+				d.payload,
+				d.attempts,
+				d.next_attempt_at,
+				r.webhook_url,
+				r.secret,
+				row_number() over (partition by h.host order by d.next_attempt_at, d.alert_delivery_id) as host_rank
+			from
+				alert_delivery d
+				join alert_rule r on r.alert_rule_id = d.alert_rule_id
+				cross join lateral (select `+webhookHostSQL+` as host) h
+			where
+				d.status = 'pending'
+				and d.next_attempt_at <= now()
+				and not (d.alert_delivery_id = any($3))
+				and not (h.host = any($4))
+		) due
+		where
+			host_rank <= $2
+		order by
+			next_attempt_at,
+			alert_delivery_id
+		limit $1
+	`, limit, perHost, pq.Array(inflight), pq.Array(busy))
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+func (db *DB) RecordAlertDeliveryAttempt(deliveryID int64, attempt int, status string, next null.Time, statusCode null.Int, sendErr error, took time.Duration) error {
+	var errText null.String
+	if sendErr != nil {
+		errText = null.StringFrom(sendErr.Error())
+	}
+
+	_, err := db.Exec(`
+		with
+		attempt as
+		(
+			insert into alert_delivery_attempt (alert_delivery_id, attempt, status_code, error, duration_ms)
+			values ($1, $2, $5, $6, $7)
+		)
+		update alert_delivery
+		set
+			status = $3,
+			attempts = $2,
+			next_attempt_at = $4,
+			delivered_at = case when $3 = 'delivered' then now() end
+		where
+			alert_delivery_id = $1
+	`, deliveryID, attempt, status, next, statusCode, errText, took.Milliseconds())
+	return err
+}
+
+// GetAlertDeliveries returns a rule's newest deliveries, only those with
+// the status if one is given, each with its attempts.
+func (db *DB) GetAlertDeliveries(ruleID int, status string, limit int) ([]*AlertDelivery, error) {
+	deliveries := []*AlertDelivery{}
+	err := db.Select(&deliveries, `
+		select
+			alert_delivery_id,
+			alert_rule_id,
+			payload,
+			status,
+			attempts,
+			next_attempt_at,
+			delivered_at,
+			created_at
+		from
+			alert_delivery
+		where
+			alert_rule_id = $1
+			and ($2 = '' or status = $2)
+		order by
+			alert_delivery_id desc
+		limit $3
+	`, ruleID, status, limit)
+	if err != nil || len(deliveries) == 0 {
+		return deliveries, err
+	}
+
+	ids := make([]int64, len(deliveries))
+	byID := make(map[int64]*AlertDelivery, len(deliveries))
+	for i, d := range deliveries {
+		d.Log = []*AlertDeliveryAttempt{}
+		ids[i] = d.AlertDeliveryID
+		byID[d.AlertDeliveryID] = d
+	}
+
+	attempts := []*AlertDeliveryAttempt{}
+	err = db.Select(&attempts, `
+		select
+			alert_delivery_attempt_id,
+			alert_delivery_id,
+			attempt,
+			status_code,
+			error,
+			duration_ms,
+			created_at
+		from
+			alert_delivery_attempt
+		where
+			alert_delivery_id = any($1)
+		order by
+			alert_delivery_id,
+			attempt
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attempts {
+		byID[a.AlertDeliveryID].Log = append(byID[a.AlertDeliveryID].Log, a)
+	}
+	return deliveries, nil
+}
+
+// ParseAlertDeliveryQuery reads the status and limit query parameters of a
+// delivery log request.
+func ParseAlertDeliveryQuery(q url.Values) (string, int, error) {
+	status := q.Get("status")
+	switch status {
+	case "", AlertDeliveryPending, AlertDeliveryDelivered, AlertDeliveryFailed:
+	default:
+		return "", 0, badRequestf("ino: invalid status '%v', must be pending, delivered or failed", status)
+	}
+
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > 1000 {
+			return "", 0, badRequestf("ino: invalid limit '%v', must be between 1 and 1000", v)
+		}
+		limit = l
+	}
+	return status, limit, nil
+}
+
+func (s *HTTPServer) GetAlertDeliveries(w http.ResponseWriter, r *http.Request) error {
+	if err := authorize(r, APIKeyAdmin); err != nil {
+		return err
+	}
+
+	ruleID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	status, limit, err := ParseAlertDeliveryQuery(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetAlertRule(ruleID); err != nil {
+		return err
+	}
+
+	deliveries, err := s.DB.GetAlertDeliveries(ruleID, status, limit)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+	return nil
+}
@@ -0,0 +1,260 @@
+package ino
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"rule":"test"}`)
+	now := time.Unix(1700000000, 0)
+	header := SignWebhook("secret", now, body)
+
+	if !strings.HasPrefix(header, "t=1700000000,v1=") {
+		t.Fatalf("unexpected signature header %q", header)
+	}
+	if err := VerifyWebhook("secret", header, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("signature didn't verify: %v", err)
+	}
+
+	bad := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		{"wrong secret", "other", header, body, now},
+		{"changed body", "secret", header, []byte(`{"rule":"other"}`), now},
+		{"too old", "secret", header, body, now.Add(webhookTolerance + time.Second)},
+		{"from the future", "secret", header, body, now.Add(-webhookTolerance - time.Second)},
+		{"malformed", "secret", "v1=abc", body, now},
+	}
+	for _, c := range bad {
+		if err := VerifyWebhook(c.secret, c.header, c.body, c.now); err == nil {
+			t.Errorf("%v: signature verified", c.name)
+		}
+	}
+}
+
+func TestWebhookPost(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := VerifyWebhook("secret", r.Header.Get(webhookSignatureHeader), body, time.Now()); err != nil {
+			t.Errorf("receiver couldn't verify webhook: %v", err)
+		}
+		if got := r.Header.Get(webhookDeliveryHeader); got != "42" {
+			t.Errorf("delivery header is %q, want 42", got)
+		}
+		if fail.Load() {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	e := &AlertEngine{client: srv.Client()}
+	d := &dueDelivery{
+		AlertDeliveryID: 42,
+		Payload:         types.JSONText(`{"rule":"test"}`),
+		WebhookURL:      srv.URL,
+		Secret:          "secret",
+	}
+
+	statusCode, err := e.post(d, time.Now())
+	if err != nil || statusCode.Int64 != http.StatusOK {
+		t.Fatalf("post = %v, %v, want 200", statusCode, err)
+	}
+
+	fail.Store(true)
+	statusCode, err = e.post(d, time.Now())
+	if err == nil || statusCode.Int64 != http.StatusServiceUnavailable {
+		t.Fatalf("post = %v, %v, want 503 and an error", statusCode, err)
+	}
+	if !strings.Contains(err.Error(), "try again") {
+		t.Errorf("error %q doesn't carry the response body", err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	e := &AlertEngine{options: AlertOptions{Backoff: 10 * time.Second, MaxBackoff: time.Hour}}
+
+	cases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			// Up to a fifth is taken off to spread retries out.
+			if d := e.backoff(c.attempt); d > c.max || d < c.max-c.max/5 {
+				t.Fatalf("backoff(%v) = %v, want between %v and %v", c.attempt, d, c.max-c.max/5, c.max)
+			}
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	db := openTestDB(t)
+
+	// The receiver turns the first two attempts away, so the delivery log
+	// should show both failures and then the success.
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received.Add(1) <= 2 {
+			http.Error(w, "not yet", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	e := newTestAlertEngine(t, db)
+	rule := addTestAlertRule(t, db, srv.URL)
+	if _, err := db.AddAlertDelivery(rule.AlertRuleID, []byte(`{"test":true}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := dispatchUntilDone(t, e, db, rule)
+	if len(deliveries) != 1 {
+		t.Fatalf("got %v deliveries, want 1", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.Status != AlertDeliveryDelivered || d.Attempts != 3 || !d.DeliveredAt.Valid {
+		t.Fatalf("delivery is %v after %v attempts, want delivered after 3", d.Status, d.Attempts)
+	}
+	if len(d.Log) != 3 {
+		t.Fatalf("log has %v attempts, want 3", len(d.Log))
+	}
+	for i, want := range []int64{500, 500, 200} {
+		a := d.Log[i]
+		if a.Attempt != i+1 || a.StatusCode.Int64 != want || a.Error.Valid != (want != 200) {
+			t.Errorf("attempt %v logged as #%v, %v, %v", i+1, a.Attempt, a.StatusCode, a.Error)
+		}
+	}
+}
+
+func TestWebhookSlowHost(t *testing.T) {
+	db := openTestDB(t)
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var inflight, peak int
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inflight++
+		peak = max(peak, inflight)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+	}))
+	defer slow.Close()
+	done := sync.OnceFunc(func() { close(release) })
+	defer done()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	e := newTestAlertEngine(t, db)
+	slowRule := addTestAlertRule(t, db, slow.URL)
+	fastRule := addTestAlertRule(t, db, fast.URL)
+	// More than a batch are waiting on the slow host, which shouldn't keep
+	// the fast one's out of the batches.
+	for i := 0; i < webhookBatch+webhookHostConcurrency; i++ {
+		if _, err := db.AddAlertDelivery(slowRule.AlertRuleID, []byte(`{"test":true}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.AddAlertDelivery(fastRule.AlertRuleID, []byte(`{"test":true}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fast host's webhook goes out while the slow one's are stuck.
+	if err := e.Dispatch(); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := dispatchUntilDone(t, e, db, fastRule)
+	if deliveries[0].Status != AlertDeliveryDelivered {
+		t.Fatalf("fast delivery is %v", deliveries[0].Status)
+	}
+
+	done()
+	dispatchUntilDone(t, e, db, slowRule)
+	mu.Lock()
+	defer mu.Unlock()
+	if peak > webhookHostConcurrency {
+		t.Errorf("%v webhooks were in flight to one host, want at most %v", peak, webhookHostConcurrency)
+	}
+}
+
+func newTestAlertEngine(t *testing.T, db *DB) *AlertEngine {
+	t.Helper()
+	e, err := NewAlertEngine(db, nil, &AlertOptions{
+		MaxAttempts: 5,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Timeout:     10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.sends.Wait)
+	return e
+}
+
+func addTestAlertRule(t *testing.T, db *DB, webhookURL string) *AlertRule {
+	t.Helper()
+	active := false
+	rule, err := db.AddAlertRule(&AlertRuleInput{
+		Name:       "webhook test",
+		Kind:       AlertWatchlist,
+		Conditions: AlertConditions{MMSIs: []int64{benchMMSI}},
+		WebhookURL: webhookURL,
+		Secret:     "secret",
+		Active:     &active,
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DeleteAlertRule(int(rule.AlertRuleID)) })
+	return rule
+}
+
+// dispatchUntilDone runs passes until none of the rule's deliveries are
+// pending, returning them.
+func dispatchUntilDone(t *testing.T, e *AlertEngine, db *DB, rule *AlertRule) []*AlertDelivery {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := e.Dispatch(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		deliveries, err := db.GetAlertDeliveries(int(rule.AlertRuleID), AlertDeliveryPending, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 0 {
+			all, err := db.GetAlertDeliveries(int(rule.AlertRuleID), "", 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return all
+		}
+	}
+	t.Fatal("deliveries are still pending")
+	return nil
+}
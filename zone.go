@@ -0,0 +1,506 @@
+package ino
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/guregu/null/v5"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/lib/pq"
+)
+
+const (
+	ZoneEventEnter = "enter"
+	ZoneEventExit  = "exit"
+	ZoneEventDwell = "dwell"
+
+	defaultZoneEventLimit = 100
+	maxZoneEventLimit     = 1000
+)
+
+// Zone is an area, like a port or a protected area, that vessels are
+// followed in and out of.
+type Zone struct {
+	ZoneID    int64          `json:"zoneId" db:"zone_id"`
+	Name      string         `json:"name" db:"name"`
+	Tags      pq.StringArray `json:"tags" db:"tags"`
+	Geometry  types.JSONText `json:"geometry" db:"geometry"`
+	CreatedAt time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time      `json:"updatedAt" db:"updated_at"`
+}
+
+// ZoneInput is the body of a request to add or replace a zone.
+type ZoneInput struct {
+	Name     string         `json:"name"`
+	Tags     []string       `json:"tags"`
+	Geometry types.JSONText `json:"geometry"`
+}
+
+// ZoneOccupant is a vessel that's in a zone.
+type ZoneOccupant struct {
+	ZoneID     int64       `json:"-" db:"zone_id"`
+	MMSI       int64       `json:"mmsi" db:"mmsi"`
+	VesselName null.String `json:"vesselName" db:"vessel_name"`
+	EnteredAt  time.Time   `json:"enteredAt" db:"entered_at"`
+	LastSeenAt time.Time   `json:"lastSeenAt" db:"last_seen_at"`
+	// Dwelling is whether the vessel has been in the zone long enough to
+	// count as dwelling there.
+	Dwelling bool `json:"dwelling" db:"dwelling"`
+}
+
+type ZoneEvent struct {
+	ZoneEventID int64     `json:"zoneEventId" db:"zone_event_id"`
+	ZoneID      int64     `json:"zoneId" db:"zone_id"`
+	MMSI        int64     `json:"mmsi" db:"mmsi"`
+	Kind        string    `json:"kind" db:"kind"`
+	Latitude    float64   `json:"latitude" db:"latitude"`
+	Longitude   float64   `json:"longitude" db:"longitude"`
+	EnteredAt   time.Time `json:"enteredAt" db:"entered_at"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+type ZoneEventFilter eventFilter
+
+// ParseZoneEventFilter reads a ZoneEventFilter from query parameters:
+//
+//	kind=enter,exit,dwell
+//	mmsi=<mmsi>
+//	from=<RFC 3339>&to=<RFC 3339>
+//	limit=<count, default 100>
+func ParseZoneEventFilter(q url.Values) (*ZoneEventFilter, error) {
+	f, err := parseEventFilter(q, []string{ZoneEventEnter, ZoneEventExit, ZoneEventDwell}, defaultZoneEventLimit, maxZoneEventLimit)
+	if err != nil {
+		return nil, err
+	}
+	filter := ZoneEventFilter(f)
+	return &filter, nil
+}
+
+// GetZones lists the zones, only those with the tag if one is given.
+func (db *DB) GetZones(tag string) ([]*Zone, error) {
+	zones := []*Zone{}
+	err := db.Select(&zones, `
+		select
+			zone_id,
+			name,
+			tags,
+			st_asgeojson(the_geog)::json geometry,
+			created_at,
+			updated_at
+		from
+			zone
+		where
+			$1 = '' or tags @> array[$1]::character varying[]
+		order by
+			zone_id
+	`, tag)
+	if err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (db *DB) GetZone(zoneID int) (*Zone, error) {
+	zone := &Zone{}
+	err := db.Get(zone, `
+		select
+			zone_id,
+			name,
+			tags,
+			st_asgeojson(the_geog)::json geometry,
+			created_at,
+			updated_at
+		from
+			zone
+		where
+			zone_id = $1
+	`, zoneID)
+	if err != nil {
+		return nil, err
+	}
+	return zone, nil
+}
+
+// ZoneGeometryProblem says what's wrong with a GeoJSON geometry as far as
+// PostGIS is concerned, or nothing if it's valid.
+func (db *DB) ZoneGeometryProblem(geometry []byte) (string, error) {
+	var valid bool
+	var reason string
+	err := db.QueryRow(`
+		select
+			st_isvalid(g),
+			st_isvalidreason(g)
+		from
+			st_geomfromgeojson($1::text) g
+	`, string(geometry)).Scan(&valid, &reason)
+	if err != nil {
+		return "", err
+	}
+	if valid {
+		return "", nil
+	}
+	return reason, nil
+}
+
+func (db *DB) AddZone(zone *ZoneInput) (*Zone, error) {
+	z := &Zone{}
+	err := db.Get(z, `
+		insert into zone (name, tags, the_geog)
+		values ($1, $2, st_setsrid(st_geomfromgeojson($3::text), 4326)::geography)
+		returning
+			zone_id,
+			name,
+			tags,
+			st_asgeojson(the_geog)::json geometry,
+			created_at,
+			updated_at
+	`, zone.Name, pq.StringArray(zone.Tags), string(zone.Geometry))
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+func (db *DB) UpdateZone(zoneID int, zone *ZoneInput) (*Zone, error) {
+	z := &Zone{}
+	err := db.Get(z, `
+		update zone
+		set
+			name = $2,
+			tags = $3,
+			the_geog = st_setsrid(st_geomfromgeojson($4::text), 4326)::geography,
+			updated_at = now()
+		where
+			zone_id = $1
+		returning
+			zone_id,
+			name,
+			tags,
+			st_asgeojson(the_geog)::json geometry,
+			created_at,
+			updated_at
+	`, zoneID, zone.Name, pq.StringArray(zone.Tags), string(zone.Geometry))
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// DeleteZone removes a zone along with its occupancy and events.
+func (db *DB) DeleteZone(zoneID int) error {
+	var deleted int64
+	err := db.QueryRow("delete from zone where zone_id = $1 returning zone_id", zoneID).Scan(&deleted)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetZoneOccupants lists every vessel in every zone, as of each one's latest
+// event.
+func (db *DB) GetZoneOccupants() ([]*ZoneOccupant, error) {
+	occupants := []*ZoneOccupant{}
+	err := db.Select(&occupants, `
+		select
+			zone_id,
+			mmsi,
+			entered_at,
+			last_seen_at,
+			dwelling
+		from
+			zone_occupancy
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return occupants, nil
+}
+
+// AddZoneEvent records an event and updates the vessel's occupancy of the
+// zone to match: gone after an exit, there otherwise.
+func (db *DB) AddZoneEvent(zoneID int64, mmsi int64, kind string, lat float64, lon float64, enteredAt time.Time, lastSeenAt time.Time, dwelling bool) error {
+	stmt, err := db.prepared(`
+		with
+		event as
+		(
+			insert into zone_event (zone_id, mmsi, kind, latitude, longitude, entered_at)
+			values ($1, $2, $3, $4, $5, $6)
+		),
+		exited as
+		(
+			delete from zone_occupancy
+			where
+				$3 = 'exit'
+				and zone_id = $1
+				and mmsi = $2
+		)
+		insert into zone_occupancy (zone_id, mmsi, entered_at, last_seen_at, dwelling)
+		select $1, $2, $6, $7, $8
+		where $3 <> 'exit'
+		on conflict (zone_id, mmsi) do update
+		set
+			entered_at = excluded.entered_at,
+			last_seen_at = excluded.last_seen_at,
+			dwelling = excluded.dwelling
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec(zoneID, mmsi, kind, lat, lon, enteredAt, lastSeenAt, dwelling)
+	return err
+}
+
+func (db *DB) GetZoneEvents(zoneID int, f *ZoneEventFilter) ([]*ZoneEvent, error) {
+	args := []interface{}{zoneID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	clauses := []string{"zone_id = $1"}
+	if len(f.Kinds) > 0 {
+		clauses = append(clauses, fmt.Sprintf("kind = any(%v)", arg(pq.Array(f.Kinds))))
+	}
+	if f.MMSI.Valid {
+		clauses = append(clauses, fmt.Sprintf("mmsi = %v", arg(f.MMSI)))
+	}
+	if f.From.Valid {
+		clauses = append(clauses, fmt.Sprintf("created_at >= %v", arg(f.From)))
+	}
+	if f.To.Valid {
+		clauses = append(clauses, fmt.Sprintf("created_at < %v", arg(f.To)))
+	}
+
+	events := []*ZoneEvent{}
+	err := db.Select(&events, `
+		select
+			zone_event_id,
+			zone_id,
+			mmsi,
+			kind,
+			latitude,
+			longitude,
+			entered_at,
+			created_at
+		from
+			zone_event
+		where
+			`+strings.Join(clauses, " and ")+`
+		order by
+			created_at desc,
+			zone_event_id desc
+		limit `+arg(f.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetVesselNames looks up the names of the given vessels, where they're
+// known.
+func (db *DB) GetVesselNames(mmsis []int64) (map[int64]string, error) {
+	var rows []struct {
+		MMSI       int64  `db:"mmsi"`
+		VesselName string `db:"vessel_name"`
+	}
+	err := db.Select(&rows, `
+		select
+			mmsi,
+			vessel_name
+		from
+			vessel
+		where
+			mmsi = any($1)
+			and vessel_name is not null
+	`, pq.Array(mmsis))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(rows))
+	for _, r := range rows {
+		names[r.MMSI] = r.VesselName
+	}
+	return names, nil
+}
+
+// validateZone checks a zone has a name and a usable shape.
+func (s *HTTPServer) validateZone(zone *ZoneInput) error {
+	zone.Name = strings.TrimSpace(zone.Name)
+	if zone.Name == "" {
+		return badRequestf("ino: name is required")
+	}
+	if zone.Tags == nil {
+		zone.Tags = []string{}
+	}
+	if len(zone.Geometry) == 0 {
+		return badRequestf("ino: geometry is required")
+	}
+	if _, err := parseZoneGeometry(zone.Geometry); err != nil {
+		return badRequestf("ino: invalid geometry: %v", err)
+	}
+	problem, err := s.DB.ZoneGeometryProblem(zone.Geometry)
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		return badRequestf("ino: invalid geometry: %v", problem)
+	}
+	return nil
+}
+
+// reloadZones has the tracker pick up a change to the zones.
+func (s *HTTPServer) reloadZones() error {
+	if s.Zones == nil {
+		return nil
+	}
+	return s.Zones.Reload()
+}
+
+func (s *HTTPServer) GetZones(w http.ResponseWriter, r *http.Request) error {
+	zones, err := s.DB.GetZones(r.URL.Query().Get("tag"))
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, zones)
+	return nil
+}
+
+func (s *HTTPServer) GetZone(w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	zone, err := s.DB.GetZone(zoneID)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, zone)
+	return nil
+}
+
+func (s *HTTPServer) CreateZone(w http.ResponseWriter, r *http.Request) error {
+	var body ZoneInput
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	if err := s.validateZone(&body); err != nil {
+		return err
+	}
+
+	zone, err := s.DB.AddZone(&body)
+	if err != nil {
+		return err
+	}
+	if err := s.reloadZones(); err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, zone)
+	return nil
+}
+
+func (s *HTTPServer) UpdateZone(w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	var body ZoneInput
+	if err := decodeBody(w, r, &body); err != nil {
+		return err
+	}
+	if err := s.validateZone(&body); err != nil {
+		return err
+	}
+
+	zone, err := s.DB.UpdateZone(zoneID, &body)
+	if err != nil {
+		return err
+	}
+	if err := s.reloadZones(); err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, zone)
+	return nil
+}
+
+func (s *HTTPServer) DeleteZone(w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := s.DB.DeleteZone(zoneID); err != nil {
+		return err
+	}
+	if err := s.reloadZones(); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// GetZoneOccupancy lists the vessels in a zone now.
+func (s *HTTPServer) GetZoneOccupancy(w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetZone(zoneID); err != nil {
+		return err
+	}
+	if s.Zones == nil {
+		return notFoundf("ino: zones aren't being tracked")
+	}
+
+	occupants := s.Zones.Occupancy(int64(zoneID))
+	mmsis := make([]int64, len(occupants))
+	for i, o := range occupants {
+		mmsis[i] = o.MMSI
+	}
+	names, err := s.DB.GetVesselNames(mmsis)
+	if err != nil {
+		return err
+	}
+	for _, o := range occupants {
+		if name, ok := names[o.MMSI]; ok {
+			o.VesselName = null.StringFrom(name)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, occupants)
+	return nil
+}
+
+func (s *HTTPServer) GetZoneEvents(w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "id")
+	if err != nil {
+		return err
+	}
+
+	filter, err := ParseZoneEventFilter(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.DB.GetZone(zoneID); err != nil {
+		return err
+	}
+
+	events, err := s.DB.GetZoneEvents(zoneID, filter)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, events)
+	return nil
+}
@@ -0,0 +1,449 @@
+package ino
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// zoneCellSize is the size, in degrees, of the grid cells zones are
+	// indexed by.
+	zoneCellSize = 0.25
+	// maxZoneCells is how many cells a zone can cover before it's checked
+	// against every position instead of being indexed.
+	maxZoneCells = 4096
+	// zoneEventBuffer is how many events can wait to be written before new
+	// ones are dropped, rather than holding up positions.
+	zoneEventBuffer = 4096
+)
+
+// ring is a closed list of longitude, latitude points.
+type ring [][2]float64
+
+// polygon is an outer ring followed by its holes.
+type polygon []ring
+
+// parseZoneGeometry reads the polygons out of a GeoJSON Polygon or
+// MultiPolygon.
+func parseZoneGeometry(geometry []byte) ([]polygon, error) {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(geometry, &g); err != nil {
+		return nil, err
+	}
+
+	var polygons []polygon
+	switch g.Type {
+	case "Polygon":
+		var p polygon
+		if err := json.Unmarshal(g.Coordinates, &p); err != nil {
+			return nil, err
+		}
+		polygons = []polygon{p}
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("ino: zone geometry has to be a Polygon or MultiPolygon, not '%v'", g.Type)
+	}
+
+	if len(polygons) == 0 {
+		return nil, fmt.Errorf("ino: zone geometry has no polygons")
+	}
+	for _, p := range polygons {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("ino: zone polygon has no rings")
+		}
+		for _, r := range p {
+			if len(r) < 4 || r[0] != r[len(r)-1] {
+				return nil, fmt.Errorf("ino: zone rings need at least 4 points and have to be closed")
+			}
+		}
+	}
+	return polygons, nil
+}
+
+// contains reports whether the point is inside the ring, by counting how
+// many of its edges a ray from the point crosses. Zones are small enough
+// that treating degrees as planar doesn't matter.
+func (r ring) contains(lon float64, lat float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > lat) != (b[1] > lat) && lon < (b[0]-a[0])*(lat-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func (p polygon) contains(lon float64, lat float64) bool {
+	if !p[0].contains(lon, lat) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(lon, lat) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexedZone is a zone's shape, ready to test positions against.
+type indexedZone struct {
+	zoneID   int64
+	bbox     [4]float64
+	polygons []polygon
+}
+
+func newIndexedZone(zoneID int64, polygons []polygon) *indexedZone {
+	z := &indexedZone{
+		zoneID:   zoneID,
+		bbox:     [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)},
+		polygons: polygons,
+	}
+	for _, p := range polygons {
+		for _, c := range p[0] {
+			z.bbox[0] = math.Min(z.bbox[0], c[0])
+			z.bbox[1] = math.Min(z.bbox[1], c[1])
+			z.bbox[2] = math.Max(z.bbox[2], c[0])
+			z.bbox[3] = math.Max(z.bbox[3], c[1])
+		}
+	}
+	return z
+}
+
+func (z *indexedZone) contains(lon float64, lat float64) bool {
+	if lon < z.bbox[0] || lat < z.bbox[1] || lon > z.bbox[2] || lat > z.bbox[3] {
+		return false
+	}
+	for _, p := range z.polygons {
+		if p.contains(lon, lat) {
+			return true
+		}
+	}
+	return false
+}
+
+type zoneCell struct {
+	x, y int
+}
+
+func cellOf(lon float64, lat float64) zoneCell {
+	return zoneCell{int(math.Floor(lon / zoneCellSize)), int(math.Floor(lat / zoneCellSize))}
+}
+
+// zoneIndex finds the zones a position is in without testing every zone,
+// by bucketing zones into the grid cells their bounding boxes cover.
+type zoneIndex struct {
+	cells map[zoneCell][]*indexedZone
+	// large are zones covering too many cells to index, which are tested
+	// against every position.
+	large []*indexedZone
+}
+
+func newZoneIndex(zones []*indexedZone) *zoneIndex {
+	idx := &zoneIndex{
+		cells: map[zoneCell][]*indexedZone{},
+	}
+	for _, z := range zones {
+		lo, hi := cellOf(z.bbox[0], z.bbox[1]), cellOf(z.bbox[2], z.bbox[3])
+		if (hi.x-lo.x+1)*(hi.y-lo.y+1) > maxZoneCells {
+			idx.large = append(idx.large, z)
+			continue
+		}
+		for x := lo.x; x <= hi.x; x++ {
+			for y := lo.y; y <= hi.y; y++ {
+				c := zoneCell{x, y}
+				idx.cells[c] = append(idx.cells[c], z)
+			}
+		}
+	}
+	return idx
+}
+
+// containing returns the ids of the zones the position is in.
+func (idx *zoneIndex) containing(lon float64, lat float64) map[int64]bool {
+	in := map[int64]bool{}
+	for _, z := range idx.cells[cellOf(lon, lat)] {
+		if z.contains(lon, lat) {
+			in[z.zoneID] = true
+		}
+	}
+	for _, z := range idx.large {
+		if z.contains(lon, lat) {
+			in[z.zoneID] = true
+		}
+	}
+	return in
+}
+
+type ZoneOptions struct {
+	// DwellAfter is how long a vessel has to stay in a zone before a dwell
+	// event is recorded for it.
+	DwellAfter time.Duration
+}
+
+// zoneVisit is a vessel being in a zone.
+type zoneVisit struct {
+	enteredAt time.Time
+	lastSeen  time.Time
+	dwelling  bool
+}
+
+// zoneEventRecord is an event waiting to be written, with the occupancy it
+// leaves behind.
+type zoneEventRecord struct {
+	zoneID   int64
+	mmsi     int64
+	kind     string
+	lat, lon float64
+	visit    zoneVisit
+}
+
+// ZoneTracker follows vessels in and out of zones as their positions are
+// stored, recording an event when one enters, exits or has dwelt long
+// enough. Who's in which zone is kept in zone_occupancy too, so it
+// survives restarts.
+type ZoneTracker struct {
+	DB      *DB
+	options ZoneOptions
+	mu      sync.Mutex
+	index   *zoneIndex
+	// visits are the zones each vessel is in, by MMSI and then zone.
+	visits map[int64]map[int64]*zoneVisit
+	// pending events are written by a goroutine of their own, in the order
+	// they happened, so positions don't wait on the database under mu.
+	pending []zoneEventRecord
+	notify  chan struct{}
+	closed  bool
+	stopped chan struct{}
+}
+
+func NewZoneTracker(db *DB, options *ZoneOptions) (*ZoneTracker, error) {
+	t := &ZoneTracker{
+		DB:      db,
+		options: *options,
+		notify:  make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	go t.write()
+	return t, nil
+}
+
+// Shutdown stops tracking, waiting for the events still queued to be
+// written.
+func (t *ZoneTracker) Shutdown() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	t.wake()
+	<-t.stopped
+}
+
+// Reload rebuilds the index from the database, after zones have been
+// added, changed or removed. Visits are read from the database the first
+// time; after that the ones in memory are ahead of it, since events are
+// written behind, so they're kept for the zones that are left.
+func (t *ZoneTracker) Reload() error {
+	zones, err := t.DB.GetZones("")
+	if err != nil {
+		return err
+	}
+	indexed := make([]*indexedZone, 0, len(zones))
+	exists := make(map[int64]bool, len(zones))
+	for _, z := range zones {
+		exists[z.ZoneID] = true
+		polygons, err := parseZoneGeometry(z.Geometry)
+		if err != nil {
+			slog.Error("Couldn't index zone", "zoneId", z.ZoneID, slog.Any("error", err))
+			continue
+		}
+		indexed = append(indexed, newIndexedZone(z.ZoneID, polygons))
+	}
+	index := newZoneIndex(indexed)
+
+	t.mu.Lock()
+	loaded := t.visits != nil
+	t.mu.Unlock()
+
+	var occupants []*ZoneOccupant
+	if !loaded {
+		if occupants, err = t.DB.GetZoneOccupants(); err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if loaded {
+		for mmsi, visits := range t.visits {
+			for zoneID := range visits {
+				if !exists[zoneID] {
+					delete(visits, zoneID)
+				}
+			}
+			if len(visits) == 0 {
+				delete(t.visits, mmsi)
+			}
+		}
+	} else {
+		visits := map[int64]map[int64]*zoneVisit{}
+		for _, o := range occupants {
+			if visits[o.MMSI] == nil {
+				visits[o.MMSI] = map[int64]*zoneVisit{}
+			}
+			visits[o.MMSI][o.ZoneID] = &zoneVisit{enteredAt: o.EnteredAt, lastSeen: o.LastSeenAt, dwelling: o.Dwelling}
+		}
+		t.visits = visits
+	}
+
+	t.index = index
+	return nil
+}
+
+// Observe checks a vessel's position against the zones, recording events
+// for any it has entered, left or dwelt in.
+func (t *ZoneTracker) Observe(mmsi int64, lat float64, lon float64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	in := t.index.containing(lon, lat)
+	visits := t.visits[mmsi]
+	if len(in) == 0 && len(visits) == 0 {
+		return
+	}
+	for _, v := range visits {
+		if at.Before(v.lastSeen) {
+			// Positions are stored concurrently, so an older one can turn up
+			// after a newer one.
+			return
+		}
+	}
+	if visits == nil {
+		visits = map[int64]*zoneVisit{}
+		t.visits[mmsi] = visits
+	}
+
+	for zoneID, v := range visits {
+		if !in[zoneID] {
+			delete(visits, zoneID)
+			t.record(zoneID, mmsi, ZoneEventExit, lat, lon, v)
+		}
+	}
+
+	for zoneID := range in {
+		v, ok := visits[zoneID]
+		if !ok {
+			v = &zoneVisit{enteredAt: at, lastSeen: at}
+			visits[zoneID] = v
+			t.record(zoneID, mmsi, ZoneEventEnter, lat, lon, v)
+			continue
+		}
+		v.lastSeen = at
+		if !v.dwelling && at.Sub(v.enteredAt) >= t.options.DwellAfter {
+			v.dwelling = true
+			t.record(zoneID, mmsi, ZoneEventDwell, lat, lon, v)
+		}
+	}
+
+	if len(visits) == 0 {
+		delete(t.visits, mmsi)
+	}
+}
+
+// record queues an event to be written. Callers hold mu, which keeps a
+// vessel's events for a zone in order. When the database has fallen too far
+// behind the event is dropped and counted, since waiting for it would hold
+// every position, and occupancy lookups, up behind mu.
+func (t *ZoneTracker) record(zoneID int64, mmsi int64, kind string, lat float64, lon float64, v *zoneVisit) {
+	if len(t.pending) >= zoneEventBuffer {
+		zoneEventsDropped.Inc()
+		return
+	}
+	t.pending = append(t.pending, zoneEventRecord{zoneID: zoneID, mmsi: mmsi, kind: kind, lat: lat, lon: lon, visit: *v})
+	t.wake()
+}
+
+func (t *ZoneTracker) wake() {
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// write stores queued events and the occupancy they leave behind, and tells
+// the alert engine about vessels entering zones, until Shutdown and there
+// are none left.
+func (t *ZoneTracker) write() {
+	defer close(t.stopped)
+	for {
+		t.mu.Lock()
+		events, closed := t.pending, t.closed
+		t.pending = nil
+		t.mu.Unlock()
+
+		if len(events) == 0 {
+			if closed {
+				return
+			}
+			<-t.notify
+			continue
+		}
+
+		for _, e := range events {
+			err := t.DB.AddZoneEvent(e.zoneID, e.mmsi, e.kind, e.lat, e.lon, e.visit.enteredAt, e.visit.lastSeen, e.visit.dwelling)
+			if err != nil {
+				slog.Error("Couldn't record zone event", "zoneId", e.zoneID, "mmsi", e.mmsi, "kind", e.kind, slog.Any("error", err))
+			}
+			if e.kind == ZoneEventEnter && t.DB.Alerts != nil {
+				t.DB.Alerts.ZoneEntered(e.zoneID, e.mmsi, e.lat, e.lon, e.visit.lastSeen)
+			}
+		}
+	}
+}
+
+// InZone reports whether a position is in a zone.
+func (t *ZoneTracker) InZone(zoneID int64, lat float64, lon float64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.index.containing(lon, lat)[zoneID]
+}
+
+// Occupancy is who's in a zone now, as of each vessel's latest position.
+func (t *ZoneTracker) Occupancy(zoneID int64) []*ZoneOccupant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	occupants := []*ZoneOccupant{}
+	for mmsi, visits := range t.visits {
+		if v, ok := visits[zoneID]; ok {
+			occupants = append(occupants, &ZoneOccupant{
+				ZoneID:     zoneID,
+				MMSI:       mmsi,
+				EnteredAt:  v.enteredAt,
+				LastSeenAt: v.lastSeen,
+				Dwelling:   v.dwelling,
+			})
+		}
+	}
+	sort.Slice(occupants, func(i, j int) bool {
+		return occupants[i].EnteredAt.Before(occupants[j].EnteredAt)
+	})
+	return occupants
+}